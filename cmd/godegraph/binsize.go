@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BinaryInfo describes the binary the sizes of nodes come from.
+type BinaryInfo struct {
+	Package string `json:"package"` // main package that was built
+	Total   int64  `json:"total"`   // sum of all symbol sizes, including unattributed ones
+}
+
+// BinarySize is the part of a binary attributed to a package.
+type BinarySize struct {
+	Own        int64 `json:"own"`        // symbols of the package itself
+	Cumulative int64 `json:"cumulative"` // symbols of the package and all its transitive imports
+}
+
+// attachBinarySize builds the main package mainPkg for the build
+// configuration, attributes the sizes of its symbols to packages and
+// records on every package node linked into the binary its own and
+// cumulative size. Cumulative sizes include external packages, so they
+// show which imports drag in large dependencies.
+func attachBinarySize(graph *Graph, mainPkg string, build buildConfig) error {
+	pkg, ok := graph.packages[mainPkg]
+	if !ok {
+		return fmt.Errorf("package %s is not part of the graph", mainPkg)
+	}
+	if pkg.Name != "main" {
+		return fmt.Errorf("package %s is not a main package", mainPkg)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "godegraph-binsize")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	binary := filepath.Join(tmpDir, "main")
+
+	fmt.Fprintf(os.Stderr, "Building %s (%s)\n", mainPkg, build)
+	buildArgs := []string{"build", "-o", binary}
+	listArgs := []string{"list", "-deps", "-f", "{{.ImportPath}}{{range .Imports}} {{.}}{{end}}"}
+	if len(build.Tags) > 0 {
+		tags := "-tags=" + strings.Join(build.Tags, ",")
+		buildArgs = append(buildArgs, tags)
+		listArgs = append(listArgs, tags)
+	}
+	if _, err := runGo(pkg.Dir, build.env(), append(buildArgs, ".")...); err != nil {
+		return fmt.Errorf("failed to build %s: %v", mainPkg, err)
+	}
+	symbols, err := runGo(pkg.Dir, build.env(), "tool", "nm", "-size", binary)
+	if err != nil {
+		return fmt.Errorf("failed to read symbols of %s: %v", mainPkg, err)
+	}
+	deps, err := runGo(pkg.Dir, build.env(), append(listArgs, ".")...)
+	if err != nil {
+		return fmt.Errorf("failed to list dependencies of %s: %v", mainPkg, err)
+	}
+
+	// Imports of every package linked into the binary
+	imports := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(deps))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			imports[fields[0]] = fields[1:]
+		}
+	}
+
+	info := &BinaryInfo{Package: mainPkg}
+	own := make(map[string]int64)
+	scanner = bufio.NewScanner(bytes.NewReader(symbols))
+	for scanner.Scan() {
+		// address, size, type and name, which may contain spaces
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] == "U" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		info.Total += size
+		if pkgPath := symbolOwner(strings.Join(fields[3:], " ")); pkgPath == "main" {
+			own[mainPkg] += size
+		} else if pkgPath != "" {
+			own[pkgPath] += size
+		}
+	}
+
+	for i, node := range graph.Nodes {
+		if _, ok := imports[node.ID]; !ok {
+			continue
+		}
+		size := &BinarySize{Own: own[node.ID]}
+		for dep := range transitiveImports(node.ID, imports) {
+			size.Cumulative += own[dep]
+		}
+		graph.Nodes[i].BinarySize = size
+	}
+	graph.Binary = info
+	return nil
+}
+
+// symbolOwner returns the package path of a symbol in "go tool nm" output,
+// including type descriptors ("type:*example.com/foo.T") and interface
+// tables ("go:itab.*example.com/foo.T,io.Reader"), or "" if unknown.
+func symbolOwner(name string) string {
+	if rest, ok := strings.CutPrefix(name, "go:itab."); ok {
+		name, _, _ = strings.Cut(rest, ",")
+	} else if rest, ok := strings.CutPrefix(name, "type:"); ok {
+		name = rest
+	} else if strings.HasPrefix(name, "go:") {
+		return ""
+	}
+	return symbolPackage(strings.TrimLeft(name, "*"))
+}
+
+// transitiveImports returns pkg and all packages it imports, directly or
+// indirectly.
+func transitiveImports(pkg string, imports map[string][]string) map[string]bool {
+	result := map[string]bool{pkg: true}
+	stack := []string{pkg}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, imp := range imports[current] {
+			if !result[imp] {
+				result[imp] = true
+				stack = append(stack, imp)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSymbolOwner(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.com/foo.(*T).Method", "example.com/foo"},
+		{"type:*example.com/foo.T", "example.com/foo"},
+		{"go:itab.*example.com/foo.T,io.Reader", "example.com/foo"},
+		{"go:buildid", ""},
+		{"gopkg.in/yaml%2ev3.(*Decoder).Decode", "gopkg.in/yaml.v3"},
+		{"type:*gopkg.in/yaml%2ev3.Node", "gopkg.in/yaml.v3"},
+		{"go:itab.*gopkg.in/yaml%252ev3.Decoder,io.Reader", "gopkg.in/yaml.v3"},
+	}
+	for _, tt := range tests {
+		if got := symbolOwner(tt.name); got != tt.want {
+			t.Errorf("symbolOwner(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransitiveImports(t *testing.T) {
+	imports := map[string][]string{
+		"cmd":  {"app", "fmt"},
+		"app":  {"lib", "fmt"},
+		"lib":  {"app"},
+		"fmt":  {"os"},
+		"tool": {"lib"},
+	}
+	want := map[string]bool{"cmd": true, "app": true, "lib": true, "fmt": true, "os": true}
+	if got := transitiveImports("cmd", imports); !reflect.DeepEqual(got, want) {
+		t.Errorf("transitiveImports(cmd) = %v, want %v", got, want)
+	}
+	if got := transitiveImports("os", imports); !reflect.DeepEqual(got, map[string]bool{"os": true}) {
+		t.Errorf("transitiveImports(os) = %v", got)
+	}
+}
+
+func TestAttachBinarySize(t *testing.T) {
+	modules := writeTypedTestModules(t)
+	graph := typedTestGraph(modules)
+	graph.packages = map[string]Package{
+		"example.com/m/cmd": {Name: "main", Dir: filepath.Join(modules[0].Dir, "cmd")},
+		"example.com/m/lib": {Name: "lib", Dir: filepath.Join(modules[0].Dir, "lib")},
+	}
+	if err := attachBinarySize(graph, "example.com/m/lib", buildConfig{}); err == nil {
+		t.Error("attachBinarySize() accepted a library")
+	}
+	if err := attachBinarySize(graph, "example.com/m/other", buildConfig{}); err == nil {
+		t.Error("attachBinarySize() accepted a package outside of the graph")
+	}
+
+	if err := attachBinarySize(graph, "example.com/m/cmd", buildConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Binary == nil || graph.Binary.Package != "example.com/m/cmd" || graph.Binary.Total == 0 {
+		t.Fatalf("binary = %+v", graph.Binary)
+	}
+	sizes := make(map[string]*BinarySize)
+	for _, node := range graph.Nodes {
+		sizes[node.ID] = node.BinarySize
+	}
+	cmd, app, lib := sizes["example.com/m/cmd"], sizes["example.com/m/app"], sizes["example.com/m/lib"]
+	if cmd == nil || app == nil || lib == nil {
+		t.Fatalf("sizes = %v", sizes)
+	}
+	if cmd.Own == 0 || app.Own == 0 || lib.Own == 0 {
+		t.Errorf("own sizes: cmd %d, app %d, lib %d", cmd.Own, app.Own, lib.Own)
+	}
+	if cmd.Cumulative != cmd.Own+app.Cumulative || app.Cumulative != app.Own+lib.Cumulative || lib.Cumulative != lib.Own {
+		t.Errorf("cumulative sizes: cmd %+v, app %+v, lib %+v", *cmd, *app, *lib)
+	}
+	if cmd.Cumulative > graph.Binary.Total {
+		t.Errorf("cumulative size of cmd %d exceeds the binary's %d", cmd.Cumulative, graph.Binary.Total)
+	}
+	if sizes["example.com/m/tools/plugin"] != nil {
+		t.Error("plugin is not linked into the binary but has a size")
+	}
+}
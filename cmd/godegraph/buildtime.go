@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// BuildInfo summarizes the compile times measured with -buildtime.
+type BuildInfo struct {
+	Total        float64     `json:"total"`        // milliseconds compiling all packages one at a time
+	Length       float64     `json:"length"`       // milliseconds on the critical path
+	CriticalPath []BuildStep `json:"criticalPath"` // longest chain of compilations, compiled first first
+}
+
+// BuildStep is a package on the critical path of the build.
+type BuildStep struct {
+	Package  string  `json:"package"`
+	Duration float64 `json:"duration"` // milliseconds
+}
+
+// BuildTime is the measured compilation of a package.
+type BuildTime struct {
+	Duration float64 `json:"duration"`           // milliseconds compiling the package
+	Finish   float64 `json:"finish"`             // milliseconds of the longest chain of compilations ending with the package
+	Critical bool    `json:"critical,omitempty"` // on the critical path of the build
+}
+
+// buildAction is an entry of the action graph written by
+// "go build -debug-actiongraph".
+type buildAction struct {
+	ID        int
+	Mode      string
+	Package   string
+	Deps      []int
+	TimeStart time.Time
+	TimeDone  time.Time
+}
+
+// attachBuildTimes rebuilds every module from scratch for the build
+// configuration, timing the compilation of each package including the
+// standard library and other external packages. The critical path is the
+// chain of compilations that takes longest when everything else runs in
+// parallel: no number of CPUs makes the build faster than it.
+func attachBuildTimes(graph *Graph, build buildConfig) error {
+	tmpDir, err := os.MkdirTemp("", "godegraph-buildtime")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	durations := make(map[string]float64)
+	deps := make(map[string]map[string]bool)
+	for i, module := range graph.Modules {
+		fmt.Fprintf(os.Stderr, "Timing build of %s (%s)\n", module.ModulePath, build)
+		actionGraph := filepath.Join(tmpDir, fmt.Sprintf("actions-%d.json", i))
+		// Build outputs are discarded, leaving no binary in the module
+		args := []string{"build", "-a", "-o", os.DevNull, "-debug-actiongraph=" + actionGraph}
+		if len(build.Tags) > 0 {
+			args = append(args, "-tags="+strings.Join(build.Tags, ","))
+		}
+		if _, err := runGo(module.Dir, build.env(), append(args, "./...")...); err != nil {
+			return fmt.Errorf("failed to build %s: %v", module.ModulePath, err)
+		}
+		if err := readActionGraph(actionGraph, durations, deps); err != nil {
+			return err
+		}
+	}
+	attachCriticalPath(graph, durations, deps)
+	return nil
+}
+
+// attachCriticalPath records the compile times of the packages and the
+// critical path of their build. Packages on it and the imports between
+// consecutive ones are marked critical.
+func attachCriticalPath(graph *Graph, durations map[string]float64, deps map[string]map[string]bool) {
+	// Longest chain of compilations ending with each package, memoized
+	finish := make(map[string]float64)
+	prev := make(map[string]string)
+	var visit func(pkg string) float64
+	visit = func(pkg string) float64 {
+		if f, ok := finish[pkg]; ok {
+			return f
+		}
+		finish[pkg] = 0 // guards against cycles, which the go command rejects anyway
+		longest := 0.0
+		for _, dep := range sortedKeys(deps[pkg]) {
+			if f := visit(dep); f > longest {
+				longest = f
+				prev[pkg] = dep
+			}
+		}
+		finish[pkg] = longest + durations[pkg]
+		return finish[pkg]
+	}
+
+	info := &BuildInfo{}
+	last := ""
+	for _, pkg := range sortedKeys(durations) {
+		info.Total += durations[pkg]
+		if f := visit(pkg); f > info.Length {
+			info.Length = f
+			last = pkg
+		}
+	}
+	critical := make(map[string]bool)
+	for pkg := last; pkg != ""; pkg = prev[pkg] {
+		critical[pkg] = true
+		info.CriticalPath = append(info.CriticalPath, BuildStep{Package: pkg, Duration: durations[pkg]})
+	}
+	for i, j := 0, len(info.CriticalPath)-1; i < j; i, j = i+1, j-1 {
+		info.CriticalPath[i], info.CriticalPath[j] = info.CriticalPath[j], info.CriticalPath[i]
+	}
+
+	for i, node := range graph.Nodes {
+		if duration, ok := durations[node.ID]; ok {
+			graph.Nodes[i].BuildTime = &BuildTime{Duration: duration, Finish: finish[node.ID], Critical: critical[node.ID]}
+		}
+	}
+	for i, link := range graph.Links {
+		graph.Links[i].Critical = critical[link.Source] && prev[link.Source] == link.Target
+	}
+	graph.Build = info
+}
+
+// readActionGraph adds the compile time of every package built in the
+// action graph to durations and the packages it waited for to deps.
+// Packages built by several modules keep their first measurement.
+func readActionGraph(filename string, durations map[string]float64, deps map[string]map[string]bool) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read action graph: %v", err)
+	}
+	var actions []buildAction
+	if err := json.Unmarshal(content, &actions); err != nil {
+		return fmt.Errorf("failed to parse action graph %s: %v", filename, err)
+	}
+	byID := make(map[int]*buildAction)
+	for i := range actions {
+		byID[actions[i].ID] = &actions[i]
+	}
+
+	for _, action := range actions {
+		if action.Mode != "build" || action.Package == "" || action.TimeStart.IsZero() {
+			continue
+		}
+		if _, ok := durations[action.Package]; !ok {
+			durations[action.Package] = float64(action.TimeDone.Sub(action.TimeStart)) / float64(time.Millisecond)
+		}
+		if deps[action.Package] == nil {
+			deps[action.Package] = make(map[string]bool)
+		}
+
+		// Compilations wait for those of their imports, possibly through
+		// other actions like cache checks
+		seen := make(map[int]bool)
+		stack := append([]int(nil), action.Deps...)
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			dep, ok := byID[id]
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			if dep.Mode == "build" && dep.Package != action.Package {
+				deps[action.Package][dep.Package] = true
+				continue
+			}
+			stack = append(stack, dep.Deps...)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, for deterministic results.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeCriticalPath prints the packages on the critical path as a table.
+func writeCriticalPath(w io.Writer, info *BuildInfo) error {
+	fmt.Fprintf(w, "Critical path: %.0fms of %.0fms compile time\n", info.Length, info.Total)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DURATION\tSHARE\tPACKAGE")
+	for _, step := range info.CriticalPath {
+		share := 0.0
+		if info.Length > 0 {
+			share = 100 * step.Duration / info.Length
+		}
+		fmt.Fprintf(tw, "%.0fms\t%.1f%%\t%s\n", step.Duration, share, step.Package)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// actionGraph is an excerpt of "go build -debug-actiongraph" output: app/api
+// waits for app/db through a nop action, and the stale entry was not run.
+const actionGraph = `[
+	{"ID": 0, "Mode": "link", "Package": "example.com/app/cmd", "Deps": [1]},
+	{"ID": 1, "Mode": "build", "Package": "example.com/app/cmd", "Deps": [2, 3],
+	 "TimeStart": "2024-01-01T00:00:00.090Z", "TimeDone": "2024-01-01T00:00:00.100Z"},
+	{"ID": 2, "Mode": "build", "Package": "example.com/app/api", "Deps": [4],
+	 "TimeStart": "2024-01-01T00:00:00.050Z", "TimeDone": "2024-01-01T00:00:00.090Z"},
+	{"ID": 3, "Mode": "build", "Package": "fmt",
+	 "TimeStart": "2024-01-01T00:00:00Z", "TimeDone": "2024-01-01T00:00:00.030Z"},
+	{"ID": 4, "Mode": "nop", "Deps": [5]},
+	{"ID": 5, "Mode": "build", "Package": "example.com/app/db",
+	 "TimeStart": "2024-01-01T00:00:00Z", "TimeDone": "2024-01-01T00:00:00.050Z"},
+	{"ID": 6, "Mode": "build", "Package": "example.com/app/stale"}
+]`
+
+// otherActionGraph measures app/db again, from another module's build.
+const otherActionGraph = `[
+	{"ID": 0, "Mode": "build", "Package": "example.com/app/db",
+	 "TimeStart": "2024-01-01T00:00:00Z", "TimeDone": "2024-01-01T00:00:00.500Z"}
+]`
+
+func readTestActionGraphs(t *testing.T) (map[string]float64, map[string]map[string]bool) {
+	t.Helper()
+	durations := make(map[string]float64)
+	deps := make(map[string]map[string]bool)
+	for i, content := range []string{actionGraph, otherActionGraph} {
+		filename := filepath.Join(t.TempDir(), "actions.json")
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := readActionGraph(filename, durations, deps); err != nil {
+			t.Fatalf("action graph %d: %v", i, err)
+		}
+	}
+	return durations, deps
+}
+
+func TestReadActionGraph(t *testing.T) {
+	durations, deps := readTestActionGraphs(t)
+	wantDurations := map[string]float64{
+		"example.com/app/cmd": 10,
+		"example.com/app/api": 40,
+		"example.com/app/db":  50,
+		"fmt":                 30,
+	}
+	if !reflect.DeepEqual(durations, wantDurations) {
+		t.Errorf("durations = %v, want %v", durations, wantDurations)
+	}
+	wantDeps := map[string]map[string]bool{
+		"example.com/app/cmd": {"example.com/app/api": true, "fmt": true},
+		"example.com/app/api": {"example.com/app/db": true},
+		"example.com/app/db":  {},
+		"fmt":                 {},
+	}
+	if !reflect.DeepEqual(deps, wantDeps) {
+		t.Errorf("deps = %v, want %v", deps, wantDeps)
+	}
+
+	filename := filepath.Join(t.TempDir(), "actions.json")
+	if err := os.WriteFile(filename, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readActionGraph(filename, durations, deps); err == nil {
+		t.Error("readActionGraph() accepted invalid JSON")
+	}
+}
+
+func criticalPathGraph(t *testing.T) *Graph {
+	t.Helper()
+	graph := &Graph{
+		Nodes: []Node{
+			{ID: "example.com/app/cmd"},
+			{ID: "example.com/app/api"},
+			{ID: "example.com/app/db"},
+			{ID: "example.com/app/docs"},
+		},
+		Links: []Link{
+			{Source: "example.com/app/cmd", Target: "example.com/app/api"},
+			{Source: "example.com/app/cmd", Target: "example.com/app/db"},
+			{Source: "example.com/app/api", Target: "example.com/app/db"},
+		},
+	}
+	durations, deps := readTestActionGraphs(t)
+	attachCriticalPath(graph, durations, deps)
+	return graph
+}
+
+func TestAttachCriticalPath(t *testing.T) {
+	graph := criticalPathGraph(t)
+	want := &BuildInfo{
+		Total:  130,
+		Length: 100,
+		CriticalPath: []BuildStep{
+			{Package: "example.com/app/db", Duration: 50},
+			{Package: "example.com/app/api", Duration: 40},
+			{Package: "example.com/app/cmd", Duration: 10},
+		},
+	}
+	if !reflect.DeepEqual(graph.Build, want) {
+		t.Errorf("build = %+v, want %+v", graph.Build, want)
+	}
+
+	wantTimes := []*BuildTime{
+		{Duration: 10, Finish: 100, Critical: true},
+		{Duration: 40, Finish: 90, Critical: true},
+		{Duration: 50, Finish: 50, Critical: true},
+		nil,
+	}
+	for i, node := range graph.Nodes {
+		if !reflect.DeepEqual(node.BuildTime, wantTimes[i]) {
+			t.Errorf("build time of %s = %+v, want %+v", node.ID, node.BuildTime, wantTimes[i])
+		}
+	}
+
+	// cmd also imports db directly, but that import is not on the path
+	var critical []bool
+	for _, link := range graph.Links {
+		critical = append(critical, link.Critical)
+	}
+	if !reflect.DeepEqual(critical, []bool{true, false, true}) {
+		t.Errorf("critical links = %v", critical)
+	}
+}
+
+func TestWriteCriticalPath(t *testing.T) {
+	var b strings.Builder
+	if err := writeCriticalPath(&b, criticalPathGraph(t).Build); err != nil {
+		t.Fatal(err)
+	}
+	want := `Critical path: 100ms of 130ms compile time
+DURATION  SHARE  PACKAGE
+50ms      50.0%  example.com/app/db
+40ms      40.0%  example.com/app/api
+10ms      10.0%  example.com/app/cmd
+`
+	if b.String() != want {
+		t.Errorf("writeCriticalPath() =\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestAttachBuildTimesLeavesNoBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("rebuilds the standard library")
+	}
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/one\n\ngo 1.22\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	graph := &Graph{
+		Nodes:   []Node{{ID: "example.com/one", Module: "example.com/one"}},
+		Modules: []ModuleInfo{{ModulePath: "example.com/one", Dir: dir}},
+	}
+	if err := attachBuildTimes(graph, buildConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Nodes[0].BuildTime == nil || graph.Build == nil {
+		t.Errorf("no build time recorded: %+v", graph.Nodes[0])
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(files) {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("module directory contains %q after the build", names)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// cacheVersion is part of every cache key; bump it whenever Package or
+// the "go list" invocation changes.
+const cacheVersion = "2"
+
+var (
+	goVersionOnce sync.Once
+	goVersion     string
+)
+
+// toolchainVersion returns the version of the go command in PATH, which
+// determines the output of "go list".
+func toolchainVersion() string {
+	goVersionOnce.Do(func() {
+		out, err := exec.Command("go", "env", "GOVERSION").Output()
+		if err == nil {
+			goVersion = strings.TrimSpace(string(out))
+		}
+	})
+	return goVersion
+}
+
+// cacheDir returns the directory holding the package cache.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "godegraph", "packages"), nil
+}
+
+// moduleCacheKey hashes everything the "go list" output of a module
+// depends on: the absolute module directory, which package directories are
+// relative to, go.mod, go.sum and the go.work in effect, the toolchain,
+// arguments, the effective go environment with the overrides in env, and
+// the paths, sizes and modification times of the module's .go files.
+// Nested modules are left out since they are cached separately.
+func moduleCacheKey(dir string, args, env []string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "version %s\ngo %s\ndir %s\nargs %q\n", cacheVersion, toolchainVersion(), absDir, args)
+
+	// "go env" also reports the settings of the go env file
+	names := []string{"GOOS", "GOARCH", "GOFLAGS", "CGO_ENABLED", "GOWORK"}
+	out, err := runGo(dir, env, append([]string{"env"}, names...)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to read go env: %v", err)
+	}
+	values := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(values) != len(names) {
+		return "", fmt.Errorf("unexpected go env output %q", out)
+	}
+	for i, name := range names {
+		fmt.Fprintf(h, "env %s=%s\n", name, values[i])
+	}
+
+	files := []string{filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum")}
+	if work := values[len(values)-1]; work != "" && work != "off" {
+		files = append(files, work, work+".sum")
+	}
+	for _, path := range files {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file %s\n", path)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var sources []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir {
+				// Directories ignored by the go command and nested modules
+				if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		sources = append(sources, fmt.Sprintf("%s %d %d", filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Fprintf(h, "src %s\n", source)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readCachedPackages returns the cached packages for key, if present.
+func readCachedPackages(key string) ([]Package, bool) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var packages []Package
+	if err := json.Unmarshal(data, &packages); err != nil {
+		return nil, false
+	}
+	return packages, true
+}
+
+// writeCachedPackages stores packages under key. The file is written to a
+// temporary name first so that concurrent runs never see partial entries.
+func writeCachedPackages(key string, packages []Package) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(packages)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, key+".json"))
+}
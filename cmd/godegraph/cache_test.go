@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeModule creates a module with one package in dir, with fixed
+// modification times so that copies hash the same files.
+func writeModule(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"go.mod":     "module example.com/m\n\ngo 1.22\n",
+		"pkg/pkg.go": "package pkg\n",
+	}
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestModuleCacheKey(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+	root := t.TempDir()
+	first := filepath.Join(root, "first", "m")
+	second := filepath.Join(root, "second", "m")
+	writeModule(t, first)
+	writeModule(t, second)
+	args := []string{"list", "-json", "./..."}
+
+	key := func(dir string, env ...string) string {
+		t.Helper()
+		k, err := moduleCacheKey(dir, args, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	base := key(first)
+	if again := key(first); again != base {
+		t.Errorf("key changed between runs: %s, %s", base, again)
+	}
+	if key(second) == base {
+		t.Error("identical checkouts in different directories share a key")
+	}
+	if key(first, "GOFLAGS=-tags=integration") == base {
+		t.Error("GOFLAGS does not change the key")
+	}
+
+	work := filepath.Join(root, "first", "go.work")
+	if err := os.WriteFile(work, []byte("go 1.22\n\nuse ./m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withWork := key(first)
+	if withWork == base {
+		t.Error("go.work does not change the key")
+	}
+	if err := os.WriteFile(work, []byte("go 1.22\n\nuse (\n\t./m\n)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if key(first) == withWork {
+		t.Error("go.work contents do not change the key")
+	}
+}
+
+func TestCachedPackages(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+
+	if _, ok := readCachedPackages("missing"); ok {
+		t.Error("readCachedPackages() hit on an empty cache")
+	}
+	packages := []Package{{ImportPath: "example.com/m/pkg", Name: "pkg", GoFiles: []string{"pkg.go"}}}
+	if err := writeCachedPackages("key", packages); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := readCachedPackages("key"); !ok || !reflect.DeepEqual(got, packages) {
+		t.Errorf("readCachedPackages() = %+v, %v, want %+v", got, ok, packages)
+	}
+
+	// A corrupted entry is a miss
+	dir, err := cacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key.json"), []byte("[{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readCachedPackages("key"); ok {
+		t.Error("readCachedPackages() hit on a corrupted entry")
+	}
+
+	// Listing a module fills the cache, and the next listing uses it
+	module := filepath.Join(t.TempDir(), "m")
+	writeModule(t, module)
+	listed, err := loadModulePackages(module, buildConfig{}, loadOptions{})
+	if err != nil || len(listed) != 1 || listed[0].ImportPath != "example.com/m/pkg" {
+		t.Fatalf("loadModulePackages() = %+v, %v", listed, err)
+	}
+	key, err := moduleCacheKey(module, goListArgs(buildConfig{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := []Package{{ImportPath: "example.com/m/cached"}}
+	if err := writeCachedPackages(key, marker); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadModulePackages(module, buildConfig{}, loadOptions{}); err != nil || !reflect.DeepEqual(got, marker) {
+		t.Errorf("loadModulePackages() = %+v, %v, want the cached packages", got, err)
+	}
+	if got, err := loadModulePackages(module, buildConfig{}, loadOptions{noCache: true}); err != nil || !reflect.DeepEqual(got, listed) {
+		t.Errorf("loadModulePackages() with noCache = %+v, %v, want %+v", got, err, listed)
+	}
+}
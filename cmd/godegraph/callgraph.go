@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// callGraphAlgorithms are the supported values of -calls.
+var callGraphAlgorithms = []string{"cha", "rta"}
+
+// callGraphLoadMode returns the load mode for the algorithm: what SSA
+// construction needs on top of typedLoadMode, and for RTA the syntax of
+// all dependencies, since it only follows calls through function bodies.
+func callGraphLoadMode(algorithm string) packages.LoadMode {
+	mode := typedLoadMode | packages.NeedTypesSizes
+	if algorithm == "rta" {
+		mode |= packages.NeedDeps
+	}
+	return mode
+}
+
+// attachCallCounts builds a static call graph of each module's packages
+// and records on each link the number of call sites in the source package
+// that may call a function of the target package. With "cha" every
+// function is a root; with "rta" only the main and init functions of main
+// packages are, so libraries are covered as far as commands reach them.
+// Calls of package initializers and calls between packages without an
+// import link, e.g. through interfaces, are not recorded.
+func attachCallCounts(graph *Graph, groups [][]*packages.Package, algorithm string) {
+	links := make(map[linkKey]int)
+	for i, link := range graph.Links {
+		links[linkKey{link.Source, link.Target}] = i
+	}
+
+	// Call sites are identified by position, since with RTA a package can
+	// be part of the programs of several modules
+	sites := make(map[int]map[string]bool)
+	for _, pkgs := range groups {
+		if len(pkgs) == 0 {
+			continue
+		}
+		var prog *ssa.Program
+		var ssaPkgs []*ssa.Package
+		if algorithm == "rta" {
+			prog, ssaPkgs = ssautil.AllPackages(pkgs, ssa.InstantiateGenerics)
+		} else {
+			prog, ssaPkgs = ssautil.Packages(pkgs, ssa.InstantiateGenerics)
+		}
+		prog.Build()
+
+		cg := buildCallGraph(prog, ssaPkgs, algorithm)
+		if cg == nil {
+			fmt.Fprintf(os.Stderr, "Warning: no main packages in module of %s, skipping call graph\n", pkgs[0].PkgPath)
+			continue
+		}
+		for fn, node := range cg.Nodes {
+			if fn == nil || fn.Pkg == nil {
+				continue
+			}
+			caller := fn.Pkg.Pkg.Path()
+			for _, edge := range node.Out {
+				callee := functionPackage(edge.Callee.Func)
+				if edge.Site == nil || !edge.Site.Pos().IsValid() || callee == "" || callee == caller {
+					continue
+				}
+				if edge.Callee.Func.Synthetic == "package initializer" {
+					continue
+				}
+				idx, ok := links[linkKey{caller, callee}]
+				if !ok {
+					continue
+				}
+				if sites[idx] == nil {
+					sites[idx] = make(map[string]bool)
+				}
+				sites[idx][prog.Fset.Position(edge.Site.Pos()).String()] = true
+			}
+		}
+	}
+
+	for idx, set := range sites {
+		graph.Links[idx].Calls = len(set)
+	}
+	graph.CallGraph = algorithm
+}
+
+// buildCallGraph computes the call graph of prog, or returns nil if RTA
+// finds no roots.
+func buildCallGraph(prog *ssa.Program, pkgs []*ssa.Package, algorithm string) *callgraph.Graph {
+	if algorithm == "cha" {
+		return cha.CallGraph(prog)
+	}
+
+	var roots []*ssa.Function
+	for _, p := range pkgs {
+		if p == nil || p.Pkg.Name() != "main" {
+			continue
+		}
+		for _, name := range []string{"main", "init"} {
+			if fn := p.Func(name); fn != nil {
+				roots = append(roots, fn)
+			}
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	return rta.Analyze(roots, true).CallGraph
+}
+
+// functionPackage returns the import path of the package declaring fn, or
+// "" for synthetic functions without one.
+func functionPackage(fn *ssa.Function) string {
+	if fn.Pkg != nil {
+		return fn.Pkg.Pkg.Path()
+	}
+	if origin := fn.Origin(); origin != nil && origin.Pkg != nil {
+		return origin.Pkg.Pkg.Path()
+	}
+	if obj := fn.Object(); obj != nil && obj.Pkg() != nil {
+		return obj.Pkg().Path()
+	}
+	return ""
+}
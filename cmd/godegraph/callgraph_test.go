@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestAttachCallCounts(t *testing.T) {
+	modules := writeTypedTestModules(t)
+	tests := []struct {
+		algorithm string
+		want      map[string]int
+	}{
+		// Every function is a root, including unused ones, and the
+		// interface call in plugin may call lib's Client.Do
+		{"cha", map[string]int{
+			"example.com/m/app":          4,
+			"example.com/m/cmd":          1,
+			"example.com/m/tools/plugin": 2,
+		}},
+		// Only what main reaches, and tools has no main package
+		{"rta", map[string]int{
+			"example.com/m/app":          3,
+			"example.com/m/cmd":          1,
+			"example.com/m/tools/plugin": 0,
+		}},
+	}
+	for _, tt := range tests {
+		groups, err := loadTypedModules(modules, buildConfig{}, modules[0].Dir, callGraphLoadMode(tt.algorithm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		graph := typedTestGraph(modules)
+		attachCallCounts(graph, groups, tt.algorithm)
+		if graph.CallGraph != tt.algorithm {
+			t.Errorf("%s: call graph = %q", tt.algorithm, graph.CallGraph)
+		}
+		for _, link := range graph.Links {
+			if link.Calls != tt.want[link.Source] {
+				t.Errorf("%s: calls of %s -> %s = %d, want %d", tt.algorithm, link.Source, link.Target, link.Calls, tt.want[link.Source])
+			}
+		}
+	}
+}
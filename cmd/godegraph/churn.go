@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Churn summarizes the git history of a package's directory.
+type Churn struct {
+	Commits      int    `json:"commits"`
+	Authors      int    `json:"authors"`      // distinct author emails
+	LastModified string `json:"lastModified"` // date of the latest commit, YYYY-MM-DD
+}
+
+// attachChurn reads the git history of rootDir since the given date or
+// duration (anything "git log --since" accepts, e.g. "90.days") and
+// records the churn of each package. Only changes to files directly in a
+// package's directory count. Packages without commits in the window are
+// left without churn.
+func attachChurn(graph *Graph, rootDir, since string) error {
+	// Map directories relative to rootDir to package nodes
+	dirs := make(map[string][]int)
+	for i, node := range graph.Nodes {
+		pkg, ok := graph.packages[node.ID]
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(rootDir, pkg.Dir)
+		if err != nil {
+			continue
+		}
+		dir := filepath.ToSlash(rel)
+		dirs[dir] = append(dirs[dir], i)
+	}
+
+	cmd := exec.Command("git", "log", "--since="+since, "--no-merges", "--relative", "--name-only",
+		"--format=%x1e%H%x1f%aE%x1f%cs")
+	cmd.Dir = rootDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git log failed: %v: %s", err, msg)
+		}
+		return fmt.Errorf("git log failed: %v", err)
+	}
+
+	authors := make(map[int]map[string]bool)
+	for _, record := range strings.Split(string(out), "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		header := strings.Split(lines[0], "\x1f")
+		if len(header) != 3 {
+			continue
+		}
+		email, date := header[1], header[2]
+
+		// A commit counts once per package, however many files it touches
+		touched := make(map[int]bool)
+		for _, file := range lines[1:] {
+			file = strings.TrimSpace(file)
+			if file == "" {
+				continue
+			}
+			for _, idx := range dirs[path.Dir(file)] {
+				touched[idx] = true
+			}
+		}
+		for idx := range touched {
+			node := &graph.Nodes[idx]
+			if node.Churn == nil {
+				node.Churn = &Churn{}
+				authors[idx] = make(map[string]bool)
+			}
+			node.Churn.Commits++
+			authors[idx][strings.ToLower(email)] = true
+			if date > node.Churn.LastModified {
+				node.Churn.LastModified = date
+			}
+		}
+	}
+	for idx, set := range authors {
+		graph.Nodes[idx].Churn.Authors = len(set)
+	}
+	return nil
+}
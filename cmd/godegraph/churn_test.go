@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttachChurn(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	root := t.TempDir()
+	git := func(env []string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commit := func(email, date string, files ...string) {
+		t.Helper()
+		for _, file := range files {
+			path := filepath.Join(root, filepath.FromSlash(file))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(email+date), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		git(nil, "add", "-A")
+		git([]string{"GIT_AUTHOR_DATE=" + date + "T12:00:00Z", "GIT_COMMITTER_DATE=" + date + "T12:00:00Z"},
+			"-c", "user.name=Test", "-c", "user.email="+email, "commit", "-q", "-m", "change")
+	}
+	git(nil, "init", "-q")
+	commit("alice@example.com", "2020-01-01", "api/a.go", "db/db.go")
+	commit("bob@example.com", "2024-03-01", "api/a.go", "api/b.go")
+	commit("Alice@Example.com", "2024-05-02", "api/v2/c.go", "db/db.go")
+	commit("bob@example.com", "2024-06-03", "api/v2/c.go")
+	commit("alice@example.com", "2024-07-04", "db/db.go")
+
+	graph := &Graph{packages: make(map[string]Package)}
+	for _, dir := range []string{"api", "api/v2", "db", "cmd"} {
+		id := "example.com/" + dir
+		graph.Nodes = append(graph.Nodes, Node{ID: id})
+		graph.packages[id] = Package{ImportPath: id, Dir: filepath.Join(root, filepath.FromSlash(dir))}
+	}
+	if err := attachChurn(graph, root, "2024-01-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]*Churn{
+		// Changes to api/v2 do not count for api, and a commit touching
+		// two of its files counts once
+		"example.com/api":    {Commits: 1, Authors: 1, LastModified: "2024-03-01"},
+		"example.com/api/v2": {Commits: 2, Authors: 2, LastModified: "2024-06-03"},
+		// Emails are compared case-insensitively, the 2020 commit is out
+		// of the window
+		"example.com/db":  {Commits: 2, Authors: 1, LastModified: "2024-07-04"},
+		"example.com/cmd": nil,
+	}
+	for _, node := range graph.Nodes {
+		if !reflect.DeepEqual(node.Churn, want[node.ID]) {
+			t.Errorf("churn of %s = %+v, want %+v", node.ID, node.Churn, want[node.ID])
+		}
+	}
+
+	if err := attachChurn(graph, t.TempDir(), "90.days"); err == nil {
+		t.Error("attachChurn() succeeded outside a git repository")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// codeownersLocations are the places GitHub and GitLab look for a
+// CODEOWNERS file, relative to the repository root.
+var codeownersLocations = []string{"CODEOWNERS", ".github/CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// ownerRule assigns owners to the paths matching a CODEOWNERS pattern.
+type ownerRule struct {
+	matcher *pathMatcher
+	owners  []string
+}
+
+// parseCodeowners reads a CODEOWNERS file. Sections and other GitLab
+// extensions are not supported; their lines are skipped.
+func parseCodeowners(filename string) ([]ownerRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ownerRule
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		fields := strings.Fields(line)
+		matcher, err := newPathMatcher(fields[:1], true)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, lineNo, err)
+		}
+		// A pattern without owners removes the ownership of its paths
+		rules = append(rules, ownerRule{matcher: matcher, owners: fields[1:]})
+	}
+	return rules, scanner.Err()
+}
+
+// findCodeowners returns the CODEOWNERS file of the repository containing
+// rootDir and the directory its patterns are relative to, or "" if there
+// is none.
+func findCodeowners(rootDir string) (string, string) {
+	repoRoot := rootDir
+	out, err := exec.Command("git", "-C", rootDir, "rev-parse", "--show-toplevel").Output()
+	if err == nil {
+		repoRoot = strings.TrimSpace(string(out))
+	}
+	for _, location := range codeownersLocations {
+		filename := filepath.Join(repoRoot, filepath.FromSlash(location))
+		if _, err := os.Stat(filename); err == nil {
+			return filename, repoRoot
+		}
+	}
+	return "", repoRoot
+}
+
+// attachOwners assigns each package the owners of most of its Go files,
+// using the last matching rule per file like GitHub does. Patterns are
+// relative to repoRoot.
+func attachOwners(graph *Graph, rules []ownerRule, repoRoot string) {
+	for i, node := range graph.Nodes {
+		pkg, ok := graph.packages[node.ID]
+		if !ok {
+			continue
+		}
+
+		votes := make(map[string]int)
+		for _, name := range append(append([]string(nil), pkg.GoFiles...), pkg.CgoFiles...) {
+			rel, err := filepath.Rel(repoRoot, filepath.Join(pkg.Dir, name))
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			var owners []string
+			for _, rule := range rules {
+				if rule.matcher.match(rel, false) {
+					owners = rule.owners
+				}
+			}
+			if len(owners) > 0 {
+				votes[strings.Join(owners, " ")]++
+			}
+		}
+
+		// Ties go to the alphabetically first owners, to stay deterministic
+		best := ""
+		for owners, n := range votes {
+			if n > votes[best] || (n == votes[best] && owners < best) {
+				best = owners
+			}
+		}
+		if best != "" {
+			owners := strings.Fields(best)
+			sort.Strings(owners)
+			graph.Nodes[i].Owners = owners
+		}
+	}
+}
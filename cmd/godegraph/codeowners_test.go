@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttachOwners(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, "CODEOWNERS")
+	content := `# Default owners
+*                   @org/core
+
+[Section]
+/api/               @org/api @alice
+/api/*_gen.go       @org/tools
+/internal/legacy/
+docs/**             @org/docs
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := parseCodeowners(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("parseCodeowners() returned %d rules, want 5", len(rules))
+	}
+
+	pkg := func(id, dir string, files ...string) (Node, Package) {
+		return Node{ID: id}, Package{ImportPath: id, Dir: filepath.Join(root, dir), GoFiles: files}
+	}
+	graph := &Graph{packages: make(map[string]Package)}
+	for _, p := range []struct {
+		dir   string
+		files []string
+	}{
+		{"api", []string{"server.go", "routes.go", "model_gen.go"}},
+		{"api/v2", []string{"a_gen.go", "b.go"}},
+		{"gen", []string{"x_gen.go", "y.go"}},
+		{"internal/legacy", []string{"old.go"}},
+		{"cmd", []string{"main.go"}},
+	} {
+		node, info := pkg("example.com/"+p.dir, p.dir, p.files...)
+		graph.Nodes = append(graph.Nodes, node)
+		graph.packages[node.ID] = info
+	}
+	graph.Nodes = append(graph.Nodes, Node{ID: "example.com/unlisted"})
+	attachOwners(graph, rules, root)
+
+	want := map[string][]string{
+		// Most files of api belong to the api team, alice included
+		"example.com/api": {"@alice", "@org/api"},
+		// /api/*_gen.go only matches files directly in api
+		"example.com/api/v2": {"@alice", "@org/api"},
+		"example.com/gen":    {"@org/core"},
+		// Legacy code was disowned
+		"example.com/internal/legacy": nil,
+		"example.com/cmd":             {"@org/core"},
+		"example.com/unlisted":        nil,
+	}
+	for _, node := range graph.Nodes {
+		if !reflect.DeepEqual(node.Owners, want[node.ID]) {
+			t.Errorf("owners of %s = %q, want %q", node.ID, node.Owners, want[node.ID])
+		}
+	}
+}
+
+func TestParseCodeownersErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "CODEOWNERS")
+	if err := os.WriteFile(filename, []byte("* @org/core\napi/[a @org/api\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseCodeowners(filename); err == nil {
+		t.Error("parseCodeowners() accepted an invalid pattern")
+	}
+	if _, err := parseCodeowners(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("parseCodeowners() accepted a missing file")
+	}
+}
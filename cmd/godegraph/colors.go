@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+)
+
+// fixedPalettes are hand-picked palettes. The colorblind-safe ones come
+// from Okabe & Ito and Paul Tol; "classic" holds the colors used by older
+// versions. They repeat when there are more modules than colors.
+var fixedPalettes = map[string][]string{
+	"okabe-ito": {"#e69f00", "#56b4e9", "#009e73", "#f0e442", "#0072b2", "#d55e00", "#cc79a7"},
+	"tol-muted": {"#cc6677", "#332288", "#ddcc77", "#117733", "#88ccee", "#882255", "#44aa99", "#999933", "#aa4499"},
+	"classic":   {"#3498db", "#9b59b6", "#f1c40f", "#e67e22", "#1abc9c", "#34495e"},
+}
+
+// defaultPalette generates distinct colors, at least generatedPaletteSize.
+const defaultPalette = "generated"
+
+// generatedPaletteSize is the number of generated colors modules hash into.
+// It only grows, by doubling, for repositories with more modules, so that
+// adding or removing a module leaves the colors of most others unchanged.
+const generatedPaletteSize = 64
+
+// minColorDistance is the CIE76 color difference (ΔE) below which two
+// module colors are hard to tell apart.
+const minColorDistance = 20
+
+// paletteNames returns the names of the available palettes.
+func paletteNames() []string {
+	names := []string{defaultPalette}
+	for name := range fixedPalettes {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// paletteColors returns the colors of the named palette for n modules.
+// The number of colors does not depend on n, except for generated palettes
+// of more than generatedPaletteSize modules.
+func paletteColors(name string, n int) ([]string, error) {
+	if name == "" || name == defaultPalette {
+		size := generatedPaletteSize
+		for size < n {
+			size *= 2
+		}
+		return generatePalette(size), nil
+	}
+	palette, ok := fixedPalettes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette %q (available: %s)", name, strings.Join(paletteNames(), ", "))
+	}
+	return palette, nil
+}
+
+// generatePalette returns n perceptually distinct colors. Hues are spread
+// by the golden angle in the CIE LCh color space, and the lightness
+// alternates between three levels so that neighbors also differ in
+// brightness once there are many hues.
+func generatePalette(n int) []string {
+	lightness := []float64{62, 48, 76}
+	colors := make([]string, n)
+	for i := range colors {
+		hue := math.Mod(float64(i)*137.508, 360)
+		colors[i] = lchToHex(lightness[i%len(lightness)], 50, hue)
+	}
+	return colors
+}
+
+// assignModuleColors gives every module a color that only depends on the
+// module paths, not on the order in which modules were discovered. Each
+// module hashes to a preferred slot of the palette and probes from there
+// for the next free slot whose color is at least minColorDistance from the
+// colors already taken, or else takes the free slot farthest from them;
+// colors are reused once all slots are taken. Modules are assigned in path
+// order, so a new module only changes the colors of modules after it.
+// Configured overrides win over the palette.
+func assignModuleColors(modules []ModuleInfo, palette string, overrides map[string]string) error {
+	colors, err := paletteColors(palette, len(modules))
+	if err != nil {
+		return err
+	}
+
+	order := make([]int, len(modules))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return modules[order[a]].ModulePath < modules[order[b]].ModulePath
+	})
+
+	labs := make([][3]float64, len(colors))
+	for i, color := range colors {
+		labs[i] = hexToLab(color)
+	}
+
+	used := make([]bool, len(colors))
+	free := len(colors)
+	var taken [][3]float64
+	for _, i := range order {
+		if free == 0 {
+			used = make([]bool, len(colors))
+			free = len(colors)
+			taken = nil
+		}
+		h := fnv.New32a()
+		h.Write([]byte(modules[i].ModulePath))
+		preferred := int(h.Sum32() % uint32(len(colors)))
+		slot, farthest := -1, -1.0
+		for n := 0; n < len(colors); n++ {
+			candidate := (preferred + n) % len(colors)
+			if used[candidate] {
+				continue
+			}
+			distance := nearestColorDistance(labs[candidate], taken)
+			if distance >= minColorDistance {
+				slot = candidate
+				break
+			}
+			if distance > farthest {
+				slot, farthest = candidate, distance
+			}
+		}
+		used[slot] = true
+		free--
+		taken = append(taken, labs[slot])
+		modules[i].Color = colors[slot]
+
+		if color, ok := overrides[modules[i].ModulePath]; ok {
+			modules[i].Color = color
+		}
+	}
+	return nil
+}
+
+// nearestColorDistance returns the distance from lab to the closest of the
+// other colors, or +Inf if there are none.
+func nearestColorDistance(lab [3]float64, others [][3]float64) float64 {
+	nearest := math.Inf(1)
+	for _, other := range others {
+		nearest = math.Min(nearest, colorDistance(lab, other))
+	}
+	return nearest
+}
+
+// colorDistance is the CIE76 color difference of two Lab colors.
+func colorDistance(x, y [3]float64) float64 {
+	return math.Sqrt((x[0]-y[0])*(x[0]-y[0]) + (x[1]-y[1])*(x[1]-y[1]) + (x[2]-y[2])*(x[2]-y[2]))
+}
+
+// lchToHex converts a CIE LCh color (D65) to an sRGB hex string. Colors
+// outside of the sRGB gamut are desaturated until they fit.
+func lchToHex(l, c, h float64) string {
+	for ; c > 0; c -= 2 {
+		if r, g, b, ok := labToRGB(l, c*math.Cos(h*math.Pi/180), c*math.Sin(h*math.Pi/180)); ok {
+			return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+		}
+	}
+	r, g, b, _ := labToRGB(l, 0, 0)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// labToRGB converts CIE Lab to 8-bit sRGB and reports whether the color
+// is inside the sRGB gamut.
+func labToRGB(l, a, b float64) (uint8, uint8, uint8, bool) {
+	// Lab to XYZ with the D65 white point
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	x := 0.95047 * finv(fx)
+	y := 1.00000 * finv(fy)
+	z := 1.08883 * finv(fz)
+
+	// XYZ to linear sRGB
+	linear := [3]float64{
+		3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z,
+	}
+
+	var out [3]uint8
+	inGamut := true
+	for i, v := range linear {
+		if v < -0.001 || v > 1.001 {
+			inGamut = false
+		}
+		v = math.Max(0, math.Min(1, v))
+		// Gamma correction
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		out[i] = uint8(math.Round(v * 255))
+	}
+	return out[0], out[1], out[2], inGamut
+}
+
+// hexToLab converts an sRGB hex string like "#3498db" to CIE Lab (D65),
+// the inverse of labToRGB. Malformed colors are black.
+func hexToLab(color string) [3]float64 {
+	var rgb [3]uint8
+	if len(color) == 7 && color[0] == '#' {
+		fmt.Sscanf(color[1:], "%02x%02x%02x", &rgb[0], &rgb[1], &rgb[2])
+	}
+	var linear [3]float64
+	for i, v := range rgb {
+		c := float64(v) / 255
+		// Inverse gamma correction
+		if c <= 0.04045 {
+			linear[i] = c / 12.92
+		} else {
+			linear[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+
+	// Linear sRGB to XYZ, relative to the D65 white point
+	x := (0.4124564*linear[0] + 0.3575761*linear[1] + 0.1804375*linear[2]) / 0.95047
+	y := 0.2126729*linear[0] + 0.7151522*linear[1] + 0.0721750*linear[2]
+	z := (0.0193339*linear[0] + 0.1191920*linear[1] + 0.9503041*linear[2]) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return t/(3*(6.0/29)*(6.0/29)) + 4.0/29
+	}
+	return [3]float64{116*f(y) - 16, 500 * (f(x) - f(y)), 200 * (f(y) - f(z))}
+}
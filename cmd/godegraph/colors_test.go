@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func moduleInfos(paths ...string) []ModuleInfo {
+	modules := make([]ModuleInfo, len(paths))
+	for i, path := range paths {
+		modules[i] = ModuleInfo{ModulePath: path}
+	}
+	return modules
+}
+
+func moduleColors(t *testing.T, modules []ModuleInfo, palette string) map[string]string {
+	t.Helper()
+	if err := assignModuleColors(modules, palette, nil); err != nil {
+		t.Fatal(err)
+	}
+	colors := make(map[string]string)
+	for _, mod := range modules {
+		colors[mod.ModulePath] = mod.Color
+	}
+	return colors
+}
+
+func TestAssignModuleColorsStable(t *testing.T) {
+	var paths []string
+	for i := 0; i < 20; i++ {
+		paths = append(paths, fmt.Sprintf("example.com/mod%d", i))
+	}
+	for _, palette := range []string{"generated", "tol-muted"} {
+		t.Run(palette, func(t *testing.T) {
+			before := moduleColors(t, moduleInfos(paths[:10]...), palette)
+
+			// Modules before the added one keep their colors
+			after := moduleColors(t, moduleInfos(append([]string{"example.com/zz"}, paths[:10]...)...), palette)
+			for path, color := range before {
+				if after[path] != color {
+					t.Errorf("%s: color changed from %s to %s by adding a module after it", path, color, after[path])
+				}
+			}
+
+			// The discovery order does not matter
+			reversed := make([]string, 10)
+			for i := range reversed {
+				reversed[i] = paths[9-i]
+			}
+			for path, color := range moduleColors(t, moduleInfos(reversed...), palette) {
+				if before[path] != color {
+					t.Errorf("%s: color %s depends on the module order, was %s", path, color, before[path])
+				}
+			}
+		})
+	}
+}
+
+func TestAssignModuleColorsDistinct(t *testing.T) {
+	// Unrelated modules get colors that are easy to tell apart
+	var services []string
+	for i := 0; i < 10; i++ {
+		services = append(services, fmt.Sprintf("github.com/acme/svc%d", i))
+	}
+	colors := moduleColors(t, moduleInfos(services...), "generated")
+	for i, a := range services {
+		for _, b := range services[i+1:] {
+			if d := colorDistance(hexToLab(colors[a]), hexToLab(colors[b])); d < minColorDistance {
+				t.Errorf("%s (%s) and %s (%s) are only %.1f apart", a, colors[a], b, colors[b], d)
+			}
+		}
+	}
+
+	// With more modules than distinct colors, colors are still not shared
+	var paths []string
+	for i := 0; i < 100; i++ {
+		paths = append(paths, fmt.Sprintf("example.com/mod%d", i))
+	}
+	seen := make(map[string]string)
+	for path, color := range moduleColors(t, moduleInfos(paths...), "generated") {
+		if other, ok := seen[color]; ok {
+			t.Errorf("%s and %s share color %s", path, other, color)
+		}
+		seen[color] = path
+	}
+}
+
+func TestAssignModuleColorsOverrides(t *testing.T) {
+	modules := moduleInfos("example.com/a", "example.com/b")
+	if err := assignModuleColors(modules, "okabe-ito", map[string]string{"example.com/b": "#123456"}); err != nil {
+		t.Fatal(err)
+	}
+	if modules[1].Color != "#123456" {
+		t.Errorf("override ignored: got %s", modules[1].Color)
+	}
+	if err := assignModuleColors(modules, "rainbow", nil); err == nil {
+		t.Error("unknown palette accepted")
+	}
+}
+
+func TestHexToLab(t *testing.T) {
+	tests := []struct {
+		color string
+		want  [3]float64
+	}{
+		{"#000000", [3]float64{0, 0, 0}},
+		{"#ffffff", [3]float64{100, 0, 0}},
+		{"#ff0000", [3]float64{53.24, 80.09, 67.20}},
+		{"#808080", [3]float64{53.59, 0, 0}},
+	}
+	for _, tt := range tests {
+		if got := hexToLab(tt.color); colorDistance(got, tt.want) > 0.1 {
+			t.Errorf("hexToLab(%s) = %.2f, want %.2f", tt.color, got, tt.want)
+		}
+	}
+
+	// Inverse of lchToHex for colors in the sRGB gamut
+	for _, hue := range []float64{0, 90, 200, 300} {
+		lab := hexToLab(lchToHex(60, 30, hue))
+		want := [3]float64{60, 30 * math.Cos(hue*math.Pi/180), 30 * math.Sin(hue*math.Pi/180)}
+		if colorDistance(lab, want) > 1 {
+			t.Errorf("hexToLab(lchToHex(60, 30, %v)) = %.2f, want %.2f", hue, lab, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Component is a named group of packages forming an architectural unit,
+// e.g. "persistence" for the store and db packages.
+type Component struct {
+	Name     string   `yaml:"name"`
+	Packages []string `yaml:"packages"` // query expressions, e.g. "*/store/..."
+}
+
+// assignComponents records on every package node the component it belongs
+// to. A package matching several components belongs to the first one.
+func assignComponents(graph *Graph, components []Component) error {
+	ix := newGraphIndex(graph)
+	for _, component := range components {
+		for _, query := range component.Packages {
+			expr, err := parseQuery(query)
+			if err != nil {
+				return fmt.Errorf("component %s: invalid query: %v", component.Name, err)
+			}
+			matchAtAnyDepth(expr)
+			matched, err := expr.eval(ix)
+			if err != nil {
+				return fmt.Errorf("component %s: failed to evaluate query: %v", component.Name, err)
+			}
+			for i, node := range graph.Nodes {
+				if matched[node.ID] && node.Component == "" {
+					graph.Nodes[i].Component = component.Name
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchAtAnyDepth rewrites the patterns of expr that start with "*/" to
+// start with ".../", so that they match at any depth like exclude patterns:
+// "*/store/..." matches github.com/acme/store/db.
+func matchAtAnyDepth(expr queryExpr) {
+	switch e := expr.(type) {
+	case *patternExpr:
+		if rest, ok := strings.CutPrefix(e.pattern, "*/"); ok {
+			e.pattern = ".../" + rest
+		}
+	case *binaryExpr:
+		matchAtAnyDepth(e.left)
+		matchAtAnyDepth(e.right)
+	case *callExpr:
+		for _, arg := range e.args {
+			matchAtAnyDepth(arg)
+		}
+	}
+}
+
+// componentGraph collapses the packages of each component into a single
+// node listing them as members, and the imports between components into
+// links weighted by the number of package imports. Packages outside of
+// components are kept as they are. A component belongs to the module of
+// most of its members.
+func componentGraph(graph *Graph) *Graph {
+	collapsed := &Graph{Modules: graph.Modules, Viewer: graph.Viewer}
+	nodeOf := make(map[string]string)
+	members := make(map[string][]string)
+	modules := make(map[string]map[string]int)
+	var names []string
+	for _, node := range graph.Nodes {
+		if node.Component == "" {
+			nodeOf[node.ID] = node.ID
+			collapsed.Nodes = append(collapsed.Nodes, Node{ID: node.ID, Module: node.Module})
+			continue
+		}
+		nodeOf[node.ID] = node.Component
+		if _, ok := members[node.Component]; !ok {
+			names = append(names, node.Component)
+			modules[node.Component] = make(map[string]int)
+		}
+		members[node.Component] = append(members[node.Component], node.ID)
+		modules[node.Component][node.Module]++
+	}
+	for _, name := range names {
+		module := ""
+		for _, candidate := range sortedKeys(modules[name]) {
+			if modules[name][candidate] > modules[name][module] {
+				module = candidate
+			}
+		}
+		sort.Strings(members[name])
+		collapsed.Nodes = append(collapsed.Nodes, Node{ID: name, Module: module, Component: name, Members: members[name]})
+	}
+
+	weights := make(map[linkKey]int)
+	var keys []linkKey
+	for _, link := range graph.Links {
+		key := linkKey{nodeOf[link.Source], nodeOf[link.Target]}
+		if key.source == key.target {
+			continue
+		}
+		if _, ok := weights[key]; !ok {
+			keys = append(keys, key)
+		}
+		weights[key]++
+	}
+	for _, key := range keys {
+		collapsed.Links = append(collapsed.Links, Link{Source: key.source, Target: key.target, Weight: weights[key]})
+	}
+	return collapsed
+}
+
+// writeComponents prints the components with their number of packages,
+// followed by the imports between them.
+func writeComponents(w io.Writer, collapsed *Graph) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGES\tCOMPONENT\tMODULE")
+	for _, node := range collapsed.Nodes {
+		if node.Component != "" {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", len(node.Members), node.ID, node.Module)
+		}
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "IMPORTS\tFROM\tTO")
+	links := append([]Link(nil), collapsed.Links...)
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Weight != links[j].Weight {
+			return links[i].Weight > links[j].Weight
+		}
+		return links[i].Source+"\n"+links[i].Target < links[j].Source+"\n"+links[j].Target
+	})
+	for _, link := range links {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", link.Weight, link.Source, link.Target)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func componentTestGraph(t *testing.T) *Graph {
+	t.Helper()
+	graph := &Graph{
+		Nodes: []Node{
+			{ID: "app/api", Module: "app"},
+			{ID: "app/store", Module: "app"},
+			{ID: "app/store/sql", Module: "app"},
+			{ID: "db/driver", Module: "db"},
+			{ID: "app/cmd", Module: "app"},
+			{ID: "app/log", Module: "app"},
+		},
+		Links: []Link{
+			{Source: "app/cmd", Target: "app/api"},
+			{Source: "app/cmd", Target: "app/log"},
+			{Source: "app/api", Target: "app/store"},
+			{Source: "app/api", Target: "app/store/sql"},
+			{Source: "app/api", Target: "app/log"},
+			{Source: "app/store", Target: "app/store/sql"},
+			{Source: "app/store/sql", Target: "db/driver"},
+			{Source: "app/store/sql", Target: "app/log"},
+		},
+	}
+	components := []Component{
+		{Name: "web", Packages: []string{"app/api", "app/cmd"}},
+		{Name: "persistence", Packages: []string{"app/store/...", "db/..."}},
+		// cmd is already part of web
+		{Name: "tools", Packages: []string{"app/cmd"}},
+	}
+	if err := assignComponents(graph, components); err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+func TestAssignComponents(t *testing.T) {
+	graph := componentTestGraph(t)
+	var got []string
+	for _, node := range graph.Nodes {
+		got = append(got, node.ID+"="+node.Component)
+	}
+	want := []string{"app/api=web", "app/store=persistence", "app/store/sql=persistence",
+		"db/driver=persistence", "app/cmd=web", "app/log="}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("components = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*/store/...", []string{"github.com/acme/store", "github.com/acme/store/db", "x/store"}},
+		{"*/db", []string{"github.com/acme/store/db"}},
+		{"github.com/*/store", []string{"github.com/acme/store"}},
+		{"*/store/... - */db", []string{"github.com/acme/store", "x/store"}},
+	}
+	for _, tt := range tests {
+		deep := &Graph{Nodes: []Node{
+			{ID: "github.com/acme/store"},
+			{ID: "github.com/acme/store/db"},
+			{ID: "github.com/acme/api"},
+			{ID: "x/store"},
+		}}
+		if err := assignComponents(deep, []Component{{Name: "persistence", Packages: []string{tt.pattern}}}); err != nil {
+			t.Fatalf("assignComponents(%q) error = %v", tt.pattern, err)
+		}
+		var matched []string
+		for _, node := range deep.Nodes {
+			if node.Component == "persistence" {
+				matched = append(matched, node.ID)
+			}
+		}
+		if !reflect.DeepEqual(matched, tt.want) {
+			t.Errorf("assignComponents(%q) matched %q, want %q", tt.pattern, matched, tt.want)
+		}
+	}
+
+	err := assignComponents(graph, []Component{{Name: "bad", Packages: []string{"deps("}}})
+	if err == nil || !strings.HasPrefix(err.Error(), "component bad: ") {
+		t.Errorf("assignComponents() error = %v", err)
+	}
+}
+
+func TestComponentGraph(t *testing.T) {
+	collapsed := componentGraph(componentTestGraph(t))
+	wantNodes := []Node{
+		{ID: "app/log", Module: "app"},
+		{ID: "web", Module: "app", Component: "web", Members: []string{"app/api", "app/cmd"}},
+		{ID: "persistence", Module: "app", Component: "persistence", Members: []string{"app/store", "app/store/sql", "db/driver"}},
+	}
+	if !reflect.DeepEqual(collapsed.Nodes, wantNodes) {
+		t.Errorf("nodes = %+v, want %+v", collapsed.Nodes, wantNodes)
+	}
+	wantLinks := []Link{
+		{Source: "web", Target: "app/log", Weight: 2},
+		{Source: "web", Target: "persistence", Weight: 2},
+		{Source: "persistence", Target: "app/log", Weight: 1},
+	}
+	if !reflect.DeepEqual(collapsed.Links, wantLinks) {
+		t.Errorf("links = %+v, want %+v", collapsed.Links, wantLinks)
+	}
+}
+
+func TestWriteComponents(t *testing.T) {
+	var b strings.Builder
+	if err := writeComponents(&b, componentGraph(componentTestGraph(t))); err != nil {
+		t.Fatal(err)
+	}
+	want := `PACKAGES  COMPONENT    MODULE
+2         web          app
+3         persistence  app
+
+IMPORTS  FROM         TO
+2        web          app/log
+2        web          persistence
+1        persistence  app/log
+`
+	if b.String() != want {
+		t.Errorf("writeComponents() =\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestLoadConfigComponents(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"components: [{name: web}]", "component 1 needs a name and packages"},
+		{"components: [{packages: [app/...]}]", "component 1 needs a name and packages"},
+		{"components: [{name: web, packages: [a]}, {name: web, packages: [b]}]", "duplicate component web"},
+		{"components: [{name: web, packages: ['deps(']}]", "component web: invalid query"},
+	}
+	for _, tt := range tests {
+		_, err := loadConfig(writeConfig(t, tt.content), true)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadConfig(%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the configuration file read from the root directory.
+const defaultConfigFile = ".godegraph.yaml"
+
+// Config holds project-wide defaults read from .godegraph.yaml. Command
+// line flags override the values of the file.
+type Config struct {
+	// Gitignore-style patterns of paths to ignore, relative to root directory
+	Ignore []string `yaml:"ignore"`
+	// Gitignore-style patterns of import paths to exclude
+	Exclude []string `yaml:"exclude"`
+	// Build configurations (goos/goarch:tags) to load and merge
+	Matrix []string `yaml:"matrix"`
+	// Files to generate; paths are relative to root directory and "-" is stdout
+	Outputs []OutputConfig `yaml:"outputs"`
+	// Module color palette, see paletteNames
+	Palette string `yaml:"palette"`
+	// Colors by module path, overriding the palette
+	Colors map[string]string `yaml:"colors"`
+	// Architecture rules checked against the graph
+	Rules []Rule `yaml:"rules"`
+	// Architectural components grouping packages
+	Components []Component `yaml:"components"`
+	// Initial state of the HTML viewer
+	Viewer ViewerOptions `yaml:"viewer"`
+}
+
+// OutputConfig describes a file to generate.
+type OutputConfig struct {
+	Path   string `yaml:"path"`
+	Format string `yaml:"format"` // derived from the file extension when empty
+}
+
+// Rule forbids packages matching the From query to import packages
+// matching the Deny query.
+type Rule struct {
+	Name string `yaml:"name"`
+	From string `yaml:"from"`
+	Deny string `yaml:"deny"`
+}
+
+// ViewerOptions holds the initial state of the HTML viewer controls.
+type ViewerOptions struct {
+	ShowImports     *bool  `yaml:"showImports" json:"showImports,omitempty"`
+	ShowImportedBy  *bool  `yaml:"showImportedBy" json:"showImportedBy,omitempty"`
+	CrossModuleOnly bool   `yaml:"crossModuleOnly" json:"crossModuleOnly,omitempty"`
+	Query           string `yaml:"query" json:"query,omitempty"`
+	Depth           int    `yaml:"depth" json:"depth,omitempty"`               // levels highlighted around the selection, up to maxViewerDepth or -1 for unlimited (default 1)
+	SizeBy          string `yaml:"sizeBy" json:"sizeBy,omitempty"`             // see viewerSizes
+	ColorBy         string `yaml:"colorBy" json:"colorBy,omitempty"`           // see viewerColorings
+	CriticalPath    bool   `yaml:"criticalPath" json:"criticalPath,omitempty"` // highlight the critical path of the build, with -buildtime
+}
+
+// viewerSizes are the values the viewer can size package nodes by.
+var viewerSizes = append(append([]string(nil), metricNames...), "binarySize", "buildTime")
+
+// viewerColorings are the ways the viewer can color nodes.
+var viewerColorings = []string{"module", "coverage", "churn", "owner", "profile", "binarySize", "buildTime"}
+
+// maxViewerDepth is the largest finite depth of the viewer depth slider.
+const maxViewerDepth = 10
+
+// loadConfig reads the configuration file at path. A missing file yields
+// an empty configuration unless required is set.
+func loadConfig(path string, required bool) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	for i, rule := range cfg.Rules {
+		if rule.From == "" || rule.Deny == "" {
+			return nil, fmt.Errorf("%s: rule %d (%s) needs both from and deny", path, i+1, rule.Name)
+		}
+		for _, query := range []string{rule.From, rule.Deny} {
+			if _, err := parseQuery(query); err != nil {
+				return nil, fmt.Errorf("%s: rule %d (%s): invalid query %q: %v", path, i+1, rule.Name, query, err)
+			}
+		}
+	}
+	names := make(map[string]bool)
+	for i, component := range cfg.Components {
+		if component.Name == "" || len(component.Packages) == 0 {
+			return nil, fmt.Errorf("%s: component %d needs a name and packages", path, i+1)
+		}
+		if names[component.Name] {
+			return nil, fmt.Errorf("%s: duplicate component %s", path, component.Name)
+		}
+		names[component.Name] = true
+		for _, query := range component.Packages {
+			if _, err := parseQuery(query); err != nil {
+				return nil, fmt.Errorf("%s: component %s: invalid query %q: %v", path, component.Name, query, err)
+			}
+		}
+	}
+	for _, value := range cfg.Matrix {
+		if _, err := parseBuildConfig(value); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if _, err := paletteColors(cfg.Palette, 0); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if cfg.Viewer.SizeBy != "" && !containsString(viewerSizes, cfg.Viewer.SizeBy) {
+		return nil, fmt.Errorf("%s: unknown viewer sizeBy %q (supported: %s)", path, cfg.Viewer.SizeBy, strings.Join(viewerSizes, ", "))
+	}
+	if cfg.Viewer.ColorBy != "" && !containsString(viewerColorings, cfg.Viewer.ColorBy) {
+		return nil, fmt.Errorf("%s: unknown viewer colorBy %q (supported: %s)", path, cfg.Viewer.ColorBy, strings.Join(viewerColorings, ", "))
+	}
+	if cfg.Viewer.Depth < -1 || cfg.Viewer.Depth > maxViewerDepth {
+		return nil, fmt.Errorf("%s: invalid viewer depth %d (supported: -1 or 0 to %d)", path, cfg.Viewer.Depth, maxViewerDepth)
+	}
+	for i, output := range cfg.Outputs {
+		if output.Path == "" {
+			return nil, fmt.Errorf("%s: output %d has no path", path, i+1)
+		}
+		if output.Format != "" && !isOutputFormat(output.Format) {
+			return nil, fmt.Errorf("%s: output %d has unknown format %q", path, i+1, output.Format)
+		}
+	}
+	return cfg, nil
+}
+
+// Violation is an import that breaks an architecture rule.
+type Violation struct {
+	Rule   string
+	Source string
+	Target string
+}
+
+// checkRules returns the links of graph that break one of the rules.
+func checkRules(graph *Graph, rules []Rule) ([]Violation, error) {
+	var violations []Violation
+	ix := newGraphIndex(graph)
+	for _, rule := range rules {
+		from, err := evalQuery(ix, rule.From)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+		deny, err := evalQuery(ix, rule.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+		for _, link := range graph.Links {
+			if from[link.Source] && deny[link.Target] {
+				violations = append(violations, Violation{Rule: rule.Name, Source: link.Source, Target: link.Target})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// resolvePath makes a configured path absolute relative to rootDir.
+func resolvePath(rootDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(rootDir, path)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".godegraph.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+ignore: [vendor, "**/mocks"]
+exclude: ["*/internal/gen/*"]
+outputs:
+  - path: deps.html
+  - path: "-"
+    format: dot
+palette: okabe-ito
+colors:
+  example.com/app: "#ff0000"
+rules:
+  - name: no-legacy
+    from: example.com/app/...
+    deny: example.com/app/legacy/...
+viewer:
+  showImportedBy: false
+  query: deps(example.com/app/...)
+  sizeBy: lines
+`)
+	cfg, err := loadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Ignore, []string{"vendor", "**/mocks"}) {
+		t.Errorf("ignore = %q", cfg.Ignore)
+	}
+	if want := []OutputConfig{{Path: "deps.html"}, {Path: "-", Format: "dot"}}; !reflect.DeepEqual(cfg.Outputs, want) {
+		t.Errorf("outputs = %+v, want %+v", cfg.Outputs, want)
+	}
+	if cfg.Colors["example.com/app"] != "#ff0000" || cfg.Palette != "okabe-ito" {
+		t.Errorf("palette %q and colors %v", cfg.Palette, cfg.Colors)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].Deny != "example.com/app/legacy/..." {
+		t.Errorf("rules = %+v", cfg.Rules)
+	}
+	if cfg.Viewer.ShowImportedBy == nil || *cfg.Viewer.ShowImportedBy || cfg.Viewer.ShowImports != nil || cfg.Viewer.SizeBy != "lines" {
+		t.Errorf("viewer = %+v", cfg.Viewer)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".godegraph.yaml")
+	if cfg, err := loadConfig(path, false); err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("optional missing config = %+v, %v", cfg, err)
+	}
+	if _, err := loadConfig(path, true); err == nil {
+		t.Error("required missing config loaded")
+	}
+	if cfg, err := loadConfig(writeConfig(t, ""), true); err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("empty config = %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadConfigViewerDepth(t *testing.T) {
+	for _, depth := range []int{-1, 0, 1, maxViewerDepth} {
+		cfg, err := loadConfig(writeConfig(t, fmt.Sprintf("viewer: {depth: %d}", depth)), true)
+		if err != nil || cfg.Viewer.Depth != depth {
+			t.Errorf("loadConfig(depth %d) = %+v, %v", depth, cfg, err)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"ignores: [vendor]", "field ignores not found"},
+		{"rules: [{name: r, from: a}]", "rule 1 (r) needs both from and deny"},
+		{"rules: [{name: r, from: a, deny: 'deps('}]", "rule 1 (r): invalid query"},
+		{"matrix: ['linux/amd64/v3']", "invalid build configuration"},
+		{"palette: rainbow", "unknown palette"},
+		{"viewer: {sizeBy: weight}", "unknown viewer sizeBy"},
+		{"viewer: {colorBy: age}", "unknown viewer colorBy"},
+		{"viewer: {depth: -2}", "invalid viewer depth -2"},
+		{"viewer: {depth: 11}", "invalid viewer depth 11 (supported: -1 or 0 to 10)"},
+		{"outputs: [{format: dot}]", "output 1 has no path"},
+		{"outputs: [{path: x, format: png}]", "output 1 has unknown format"},
+	}
+	for _, tt := range tests {
+		_, err := loadConfig(writeConfig(t, tt.content), true)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadConfig(%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	graph := &Graph{
+		Nodes: []Node{{ID: "app/api"}, {ID: "app/legacy"}, {ID: "app/legacy/db"}, {ID: "lib"}},
+		Links: []Link{
+			{Source: "app/api", Target: "app/legacy/db"},
+			{Source: "app/api", Target: "lib"},
+			{Source: "app/legacy", Target: "app/legacy/db"},
+		},
+	}
+	rules := []Rule{{Name: "no-legacy", From: "app/... - app/legacy/...", Deny: "app/legacy/..."}}
+	violations, err := checkRules(graph, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Violation{{Rule: "no-legacy", Source: "app/api", Target: "app/legacy/db"}}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("checkRules() = %+v, want %+v", violations, want)
+	}
+	if _, err := checkRules(graph, []Rule{{Name: "bad", From: "(", Deny: "lib"}}); err == nil {
+		t.Error("invalid rule query accepted")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// ModuleCoupling counts the imports from packages of one module into
+// packages of another.
+type ModuleCoupling struct {
+	From    string          `json:"from"`
+	To      string          `json:"to"`
+	Edges   int             `json:"edges"`
+	Imports []PackageImport `json:"imports"`
+}
+
+// PackageImport is an import of one package by another.
+type PackageImport struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// moduleCoupling aggregates the cross-module links of graph by pair of
+// modules, most coupled first.
+func moduleCoupling(graph *Graph) []ModuleCoupling {
+	modules := make(map[string]string)
+	for _, node := range graph.Nodes {
+		modules[node.ID] = node.Module
+	}
+
+	byPair := make(map[[2]string]*ModuleCoupling)
+	var result []*ModuleCoupling
+	for _, link := range graph.Links {
+		from, to := modules[link.Source], modules[link.Target]
+		if from == to {
+			continue
+		}
+		c, ok := byPair[[2]string{from, to}]
+		if !ok {
+			c = &ModuleCoupling{From: from, To: to}
+			byPair[[2]string{from, to}] = c
+			result = append(result, c)
+		}
+		c.Edges++
+		c.Imports = append(c.Imports, PackageImport{Source: link.Source, Target: link.Target})
+	}
+
+	couplings := make([]ModuleCoupling, 0, len(result))
+	for _, c := range result {
+		sort.Slice(c.Imports, func(i, j int) bool {
+			if c.Imports[i].Source != c.Imports[j].Source {
+				return c.Imports[i].Source < c.Imports[j].Source
+			}
+			return c.Imports[i].Target < c.Imports[j].Target
+		})
+		couplings = append(couplings, *c)
+	}
+	sort.Slice(couplings, func(i, j int) bool {
+		if couplings[i].Edges != couplings[j].Edges {
+			return couplings[i].Edges > couplings[j].Edges
+		}
+		if couplings[i].From != couplings[j].From {
+			return couplings[i].From < couplings[j].From
+		}
+		return couplings[i].To < couplings[j].To
+	})
+	return couplings
+}
+
+// writeCoupling prints the module couplings as a table, followed by the
+// underlying imports if verbose is set.
+func writeCoupling(w io.Writer, couplings []ModuleCoupling, verbose bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "EDGES\tFROM\tTO")
+	for _, c := range couplings {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", c.Edges, c.From, c.To)
+		if verbose {
+			for _, imp := range c.Imports {
+				fmt.Fprintf(tw, "\t  %s\t  %s\n", imp.Source, imp.Target)
+			}
+		}
+	}
+	return tw.Flush()
+}
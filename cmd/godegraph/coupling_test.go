@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func couplingGraph() *Graph {
+	return &Graph{
+		Nodes: []Node{
+			{ID: "app/api", Module: "app"},
+			{ID: "app/cmd", Module: "app"},
+			{ID: "lib/db", Module: "lib"},
+			{ID: "lib/log", Module: "lib"},
+			{ID: "util", Module: "util"},
+		},
+		Links: []Link{
+			{Source: "app/cmd", Target: "lib/log"},
+			{Source: "app/api", Target: "lib/log"},
+			{Source: "app/api", Target: "lib/db"},
+			{Source: "app/cmd", Target: "app/api"},
+			{Source: "lib/db", Target: "lib/log"},
+			{Source: "lib/log", Target: "util"},
+			{Source: "app/cmd", Target: "util"},
+		},
+	}
+}
+
+func TestModuleCoupling(t *testing.T) {
+	got := moduleCoupling(couplingGraph())
+	want := []ModuleCoupling{
+		{From: "app", To: "lib", Edges: 3, Imports: []PackageImport{
+			{Source: "app/api", Target: "lib/db"},
+			{Source: "app/api", Target: "lib/log"},
+			{Source: "app/cmd", Target: "lib/log"},
+		}},
+		{From: "app", To: "util", Edges: 1, Imports: []PackageImport{{Source: "app/cmd", Target: "util"}}},
+		{From: "lib", To: "util", Edges: 1, Imports: []PackageImport{{Source: "lib/log", Target: "util"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("moduleCoupling() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteCoupling(t *testing.T) {
+	couplings := moduleCoupling(couplingGraph())
+	tests := []struct {
+		verbose bool
+		want    string
+	}{
+		{false, `EDGES  FROM  TO
+3      app   lib
+1      app   util
+1      lib   util
+`},
+		{true, `EDGES  FROM       TO
+3      app        lib
+         app/api    lib/db
+         app/api    lib/log
+         app/cmd    lib/log
+1      app        util
+         app/cmd    util
+1      lib        util
+         lib/log    util
+`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := writeCoupling(&b, couplings, tt.verbose); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("writeCoupling(verbose=%v) =\n%s\nwant:\n%s", tt.verbose, b.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"text/tabwriter"
+
+	"golang.org/x/tools/cover"
+)
+
+// Coverage is the statement coverage of a package.
+type Coverage struct {
+	Statements int     `json:"statements"`
+	Covered    int     `json:"covered"`
+	Percent    float64 `json:"percent"`
+}
+
+// loadCoverProfiles parses the cover profiles and returns the coverage of
+// each package by import path. A block counts as covered if any profile
+// covered it, so profiles of separate test runs can be merged.
+func loadCoverProfiles(paths []string) (map[string]*Coverage, error) {
+	type blockKey struct {
+		file                                 string
+		startLine, startCol, endLine, endCol int
+	}
+	statements := make(map[blockKey]int)
+	covered := make(map[blockKey]bool)
+	for _, p := range paths {
+		profiles, err := cover.ParseProfiles(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cover profile %s: %v", p, err)
+		}
+		for _, profile := range profiles {
+			for _, block := range profile.Blocks {
+				key := blockKey{profile.FileName, block.StartLine, block.StartCol, block.EndLine, block.EndCol}
+				statements[key] = block.NumStmt
+				if block.Count > 0 {
+					covered[key] = true
+				}
+			}
+		}
+	}
+
+	coverage := make(map[string]*Coverage)
+	for key, n := range statements {
+		pkg := path.Dir(key.file)
+		c, ok := coverage[pkg]
+		if !ok {
+			c = &Coverage{}
+			coverage[pkg] = c
+		}
+		c.Statements += n
+		if covered[key] {
+			c.Covered += n
+		}
+	}
+	for _, c := range coverage {
+		if c.Statements > 0 {
+			c.Percent = 100 * float64(c.Covered) / float64(c.Statements)
+		}
+	}
+	return coverage, nil
+}
+
+// attachCoverage records the coverage of each package node. Packages
+// missing from the profiles are left without coverage.
+func attachCoverage(graph *Graph, coverage map[string]*Coverage) {
+	for i, node := range graph.Nodes {
+		graph.Nodes[i].Coverage = coverage[node.ID]
+	}
+}
+
+// Hotspot is a package ranked by the risk of changing it.
+type Hotspot struct {
+	Package    string    `json:"package"`
+	Module     string    `json:"module"`
+	Dependents int       `json:"dependents"` // packages importing it directly or indirectly
+	Coverage   *Coverage `json:"coverage,omitempty"`
+	Risk       float64   `json:"risk"` // dependents times the uncovered fraction
+}
+
+// rankHotspots orders the packages with statements by risk: packages many
+// others depend on but whose tests cover little come first. Packages
+// without coverage data count as uncovered.
+func rankHotspots(graph *Graph) []Hotspot {
+	ix := newGraphIndex(graph)
+	var hotspots []Hotspot
+	for _, node := range graph.Nodes {
+		if node.Coverage != nil && node.Coverage.Statements == 0 {
+			continue
+		}
+		dependents := len(ix.reach(nodeSet{node.ID: true}, ix.importedBy, -1)) - 1
+		uncovered := 1.0
+		if node.Coverage != nil {
+			uncovered = 1 - node.Coverage.Percent/100
+		}
+		hotspots = append(hotspots, Hotspot{
+			Package:    node.ID,
+			Module:     node.Module,
+			Dependents: dependents,
+			Coverage:   node.Coverage,
+			Risk:       float64(dependents) * uncovered,
+		})
+	}
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		if hotspots[i].Risk != hotspots[j].Risk {
+			return hotspots[i].Risk > hotspots[j].Risk
+		}
+		return hotspots[i].Package < hotspots[j].Package
+	})
+	return hotspots
+}
+
+// writeHotspots prints the hotspots as a table.
+func writeHotspots(w io.Writer, hotspots []Hotspot) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RISK\tDEPENDENTS\tCOVERAGE\tPACKAGE")
+	for _, h := range hotspots {
+		coverage := "n/a"
+		if h.Coverage != nil {
+			coverage = fmt.Sprintf("%.1f%%", h.Coverage.Percent)
+		}
+		fmt.Fprintf(tw, "%.1f\t%d\t%s\t%s\n", h.Risk, h.Dependents, coverage, h.Package)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadCoverProfiles(t *testing.T) {
+	dir := t.TempDir()
+	unit := filepath.Join(dir, "unit.out")
+	integration := filepath.Join(dir, "integration.out")
+	files := map[string]string{
+		unit: `mode: set
+example.com/app/api/api.go:3.20,5.2 2 1
+example.com/app/api/api.go:7.20,9.2 3 0
+example.com/app/db/db.go:3.20,5.2 5 0
+`,
+		// A second run covering another block of api and nothing new in db
+		integration: `mode: set
+example.com/app/api/api.go:3.20,5.2 2 0
+example.com/app/api/api.go:7.20,9.2 3 1
+example.com/app/api/server.go:3.20,5.2 5 0
+example.com/app/db/db.go:3.20,5.2 5 0
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	coverage, err := loadCoverProfiles([]string{unit, integration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*Coverage{
+		"example.com/app/api": {Statements: 10, Covered: 5, Percent: 50},
+		"example.com/app/db":  {Statements: 5, Covered: 0, Percent: 0},
+	}
+	if !reflect.DeepEqual(coverage, want) {
+		t.Errorf("loadCoverProfiles() = %v, want %v", coverage, want)
+	}
+
+	if _, err := loadCoverProfiles([]string{filepath.Join(dir, "missing.out")}); err == nil {
+		t.Error("loadCoverProfiles() accepted a missing profile")
+	}
+}
+
+func hotspotGraph() *Graph {
+	graph := &Graph{
+		Nodes: []Node{
+			{ID: "app/cmd", Module: "app"},
+			{ID: "app/api", Module: "app"},
+			{ID: "app/db", Module: "app"},
+			{ID: "app/gen", Module: "app"},
+			{ID: "app/log", Module: "app"},
+		},
+		Links: []Link{
+			{Source: "app/cmd", Target: "app/api"},
+			{Source: "app/api", Target: "app/db"},
+			{Source: "app/api", Target: "app/log"},
+			{Source: "app/db", Target: "app/log"},
+			{Source: "app/cmd", Target: "app/gen"},
+		},
+	}
+	attachCoverage(graph, map[string]*Coverage{
+		"app/cmd": {Statements: 4, Covered: 0, Percent: 0},
+		"app/api": {Statements: 10, Covered: 5, Percent: 50},
+		"app/db":  {Statements: 8, Covered: 8, Percent: 100},
+		"app/gen": {},
+	})
+	return graph
+}
+
+func TestRankHotspots(t *testing.T) {
+	graph := hotspotGraph()
+	if graph.Nodes[4].Coverage != nil {
+		t.Errorf("attachCoverage() set coverage of a package missing from the profiles")
+	}
+
+	var got []string
+	for _, h := range rankHotspots(graph) {
+		got = append(got, h.Package)
+	}
+	// log has no coverage data and three dependents, api is half covered
+	// with one dependent, db is fully covered and gen has no statements
+	want := []string{"app/log", "app/api", "app/cmd", "app/db"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankHotspots() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteHotspots(t *testing.T) {
+	var b strings.Builder
+	if err := writeHotspots(&b, rankHotspots(hotspotGraph())); err != nil {
+		t.Fatal(err)
+	}
+	want := `RISK  DEPENDENTS  COVERAGE  PACKAGE
+3.0   3           n/a       app/log
+0.5   1           50.0%     app/api
+0.0   0           0.0%      app/cmd
+0.0   2           100.0%    app/db
+`
+	if b.String() != want {
+		t.Errorf("writeHotspots() =\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DSM is a dependency structure matrix: the cell of row i and column j is
+// the weight of the import of package j by package i. Packages are ordered
+// by module and then so that they only import earlier packages, which puts
+// all weights below the diagonal except those of import cycles: these form
+// blocks on the diagonal with weights above it.
+type DSM struct {
+	Packages []string
+	Modules  []string // module of each package
+	Cycles   []int    // per package, the index of its import cycle or -1
+	Cells    map[[2]int]int
+}
+
+// linkWeight is the weight of an import in the matrix: the number of
+// package imports in component graphs, the number of call sites with
+// -calls, the number of symbol uses with -symbols, otherwise 1.
+func linkWeight(graph *Graph, link Link) int {
+	weight := link.Weight
+	if weight > 0 {
+		return weight
+	}
+	if graph.CallGraph != "" {
+		weight = link.Calls
+	} else {
+		for _, sym := range link.Symbols {
+			weight += sym.Count
+		}
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
+
+// buildDSM orders the packages of graph into a dependency structure matrix.
+// Modules are ordered like packages, so modules that others depend on come
+// first.
+func buildDSM(graph *Graph) *DSM {
+	ix := newGraphIndex(graph)
+	var ids []string
+	for _, node := range graph.Nodes {
+		ids = append(ids, node.ID)
+	}
+	sort.Strings(ids)
+	packageOrder := stronglyConnected(ids, ix.imports)
+
+	moduleImports := make(map[string][]string)
+	var modules []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		module := ix.nodes[id].Module
+		if !seen[module] {
+			seen[module] = true
+			modules = append(modules, module)
+		}
+		for _, imp := range ix.imports[id] {
+			if target := ix.nodes[imp].Module; target != module {
+				moduleImports[module] = append(moduleImports[module], target)
+			}
+		}
+	}
+	moduleOrder := stronglyConnected(modules, moduleImports)
+
+	// Modules importing each other share a component, so their packages
+	// are kept apart by module path
+	sort.SliceStable(ids, func(i, j int) bool {
+		mi, mj := ix.nodes[ids[i]].Module, ix.nodes[ids[j]].Module
+		if moduleOrder[mi] != moduleOrder[mj] {
+			return moduleOrder[mi] < moduleOrder[mj]
+		}
+		if mi != mj {
+			return mi < mj
+		}
+		return packageOrder[ids[i]] < packageOrder[ids[j]]
+	})
+
+	dsm := &DSM{Packages: ids, Cells: make(map[[2]int]int)}
+	index := make(map[string]int)
+	size := make(map[int]int)
+	for i, id := range ids {
+		index[id] = i
+		dsm.Modules = append(dsm.Modules, ix.nodes[id].Module)
+		size[packageOrder[id]]++
+	}
+
+	// Number the cycles in matrix order
+	cycles := make(map[int]int)
+	for _, id := range ids {
+		component := packageOrder[id]
+		if size[component] < 2 {
+			dsm.Cycles = append(dsm.Cycles, -1)
+			continue
+		}
+		if _, ok := cycles[component]; !ok {
+			cycles[component] = len(cycles)
+		}
+		dsm.Cycles = append(dsm.Cycles, cycles[component])
+	}
+
+	for _, link := range graph.Links {
+		source, ok1 := index[link.Source]
+		target, ok2 := index[link.Target]
+		if ok1 && ok2 {
+			dsm.Cells[[2]int{source, target}] += linkWeight(graph, link)
+		}
+	}
+	return dsm
+}
+
+// stronglyConnected partitions the nodes into strongly connected components
+// with Tarjan's algorithm and returns the component of each node. Components
+// are numbered in reverse topological order: a component only has edges to
+// itself and components with lower numbers.
+func stronglyConnected(nodes []string, edges map[string][]string) map[string]int {
+	component := make(map[string]int)
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	count := 0
+
+	var visit func(node string)
+	visit = func(node string) {
+		index[node] = len(index)
+		lowlink[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, next := range edges[node] {
+			if _, ok := index[next]; !ok {
+				visit(next)
+				lowlink[node] = min(lowlink[node], lowlink[next])
+			} else if onStack[next] {
+				lowlink[node] = min(lowlink[node], index[next])
+			}
+		}
+		if lowlink[node] == index[node] {
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component[top] = count
+				if top == node {
+					break
+				}
+			}
+			count++
+		}
+	}
+	for _, node := range nodes {
+		if _, ok := index[node]; !ok {
+			visit(node)
+		}
+	}
+	return component
+}
+
+// writeDSM renders the matrix as text, with the packages numbered along the
+// rows and columns. Packages in import cycles are marked with the number of
+// their cycle.
+func writeDSM(w io.Writer, graph *Graph) error {
+	dsm := buildDSM(graph)
+	n := len(dsm.Packages)
+	width := len(strconv.Itoa(n))
+	for _, weight := range dsm.Cells {
+		width = max(width, len(strconv.Itoa(weight)))
+	}
+	labelWidth := len(strconv.Itoa(n)) + 1
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", labelWidth))
+	for j := range dsm.Packages {
+		fmt.Fprintf(&b, " %*d", width, j+1)
+	}
+	b.WriteString("\n")
+	module := ""
+	for i, pkg := range dsm.Packages {
+		if dsm.Modules[i] != module {
+			module = dsm.Modules[i]
+			fmt.Fprintf(&b, "# %s\n", module)
+		}
+		fmt.Fprintf(&b, "%*d", labelWidth, i+1)
+		for j := range dsm.Packages {
+			cell := "."
+			if i == j {
+				cell = "-"
+			} else if weight := dsm.Cells[[2]int{i, j}]; weight > 0 {
+				cell = strconv.Itoa(weight)
+			}
+			fmt.Fprintf(&b, " %*s", width, cell)
+		}
+		fmt.Fprintf(&b, "  %s", pkg)
+		if dsm.Cycles[i] >= 0 {
+			fmt.Fprintf(&b, " (cycle %d)", dsm.Cycles[i]+1)
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeDSMCSV renders the matrix as CSV, with the package and module of
+// each row in the first two columns and empty cells for no import.
+func writeDSMCSV(w io.Writer, graph *Graph) error {
+	dsm := buildDSM(graph)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"package", "module"}, dsm.Packages...)); err != nil {
+		return err
+	}
+	for i, pkg := range dsm.Packages {
+		row := []string{pkg, dsm.Modules[i]}
+		for j := range dsm.Packages {
+			cell := ""
+			if weight := dsm.Cells[[2]int{i, j}]; weight > 0 {
+				cell = strconv.Itoa(weight)
+			}
+			row = append(row, cell)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStronglyConnected(t *testing.T) {
+	edges := map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"b", "d"},
+		"e": {"a"},
+	}
+	component := stronglyConnected([]string{"a", "b", "c", "d", "e"}, edges)
+	if component["b"] != component["c"] {
+		t.Errorf("b and c are in components %d and %d, want the same", component["b"], component["c"])
+	}
+	// Components only have edges to lower numbers
+	for from, targets := range edges {
+		for _, to := range targets {
+			if component[from] != component[to] && component[from] < component[to] {
+				t.Errorf("edge %s -> %s goes from component %d to %d", from, to, component[from], component[to])
+			}
+		}
+	}
+	if n := len(map[int]bool{component["a"]: true, component["b"]: true, component["d"]: true, component["e"]: true}); n != 4 {
+		t.Errorf("got %d components, want 4", n)
+	}
+}
+
+func dsmGraph(links ...[2]string) *Graph {
+	graph := &Graph{}
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			module, _, _ := strings.Cut(id, "/")
+			graph.Nodes = append(graph.Nodes, Node{ID: id, Module: module})
+		}
+	}
+	for _, link := range links {
+		add(link[0])
+		add(link[1])
+		graph.Links = append(graph.Links, Link{Source: link[0], Target: link[1]})
+	}
+	return graph
+}
+
+func TestBuildDSM(t *testing.T) {
+	// Type-like cycle between b/x and b/y, and b depending on a
+	graph := dsmGraph(
+		[2]string{"b/z", "b/x"},
+		[2]string{"b/x", "b/y"},
+		[2]string{"b/y", "b/x"},
+		[2]string{"b/y", "a/p"},
+		[2]string{"a/q", "a/p"},
+	)
+	graph.Links[0].Weight = 3
+	dsm := buildDSM(graph)
+
+	wantModules := []string{"a", "a", "b", "b", "b"}
+	if !reflect.DeepEqual(dsm.Modules, wantModules) {
+		t.Fatalf("modules = %v, want %v", dsm.Modules, wantModules)
+	}
+	index := make(map[string]int)
+	for i, pkg := range dsm.Packages {
+		index[pkg] = i
+	}
+	if index["a/p"] > index["a/q"] || index["b/z"] < index["b/x"] || index["b/z"] < index["b/y"] {
+		t.Errorf("packages %v are not ordered by dependencies", dsm.Packages)
+	}
+	if dsm.Cycles[index["b/x"]] != 0 || dsm.Cycles[index["b/y"]] != 0 || dsm.Cycles[index["b/z"]] != -1 {
+		t.Errorf("cycles = %v for %v", dsm.Cycles, dsm.Packages)
+	}
+	if w := dsm.Cells[[2]int{index["b/z"], index["b/x"]}]; w != 3 {
+		t.Errorf("weight of b/z -> b/x = %d, want 3", w)
+	}
+	if w := dsm.Cells[[2]int{index["a/q"], index["a/p"]}]; w != 1 {
+		t.Errorf("weight of a/q -> a/p = %d, want 1", w)
+	}
+}
+
+func TestBuildDSMModuleCycle(t *testing.T) {
+	// Modules a and b import each other without a package cycle
+	graph := dsmGraph(
+		[2]string{"a/1", "b/1"},
+		[2]string{"b/2", "a/2"},
+		[2]string{"b/1", "a/3"},
+		[2]string{"a/3", "b/3"},
+	)
+	dsm := buildDSM(graph)
+	for i := 1; i < len(dsm.Modules); i++ {
+		if dsm.Modules[i] != dsm.Modules[i-1] {
+			for _, module := range dsm.Modules[i:] {
+				if module == dsm.Modules[i-1] {
+					t.Fatalf("packages of the modules interleave: %v", dsm.Packages)
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	if err := writeDSM(&b, graph); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(b.String(), "# a\n"); n != 1 {
+		t.Errorf("module a has %d headers:\n%s", n, b.String())
+	}
+}
+
+func TestWriteDSM(t *testing.T) {
+	graph := dsmGraph([2]string{"m/b", "m/a"})
+	var b strings.Builder
+	if err := writeDSM(&b, graph); err != nil {
+		t.Fatal(err)
+	}
+	want := "   1 2\n# m\n 1 - .  m/a\n 2 1 -  m/b\n"
+	if b.String() != want {
+		t.Errorf("writeDSM() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := writeDSMCSV(&b, graph); err != nil {
+		t.Fatal(err)
+	}
+	want = "package,module,m/a,m/b\nm/a,m,,\nm/b,m,1,\n"
+	if b.String() != want {
+		t.Errorf("writeDSMCSV() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
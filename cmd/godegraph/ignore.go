@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pathPattern is a single gitignore-style pattern.
+//
+// Supported syntax:
+//   - "*", "?" and "[...]" match within a single path element
+//   - "**" matches any number of path elements
+//   - a leading "!" negates the pattern, re-including previously ignored paths
+//   - a trailing "/" only matches directories
+//   - a leading or inner "/" anchors the pattern at the root; other patterns
+//     match at any depth
+//   - a "re:" prefix introduces a regular expression that is searched for in
+//     the slash-separated path
+type pathPattern struct {
+	negate  bool
+	dirOnly bool
+	elems   []string
+	regex   *regexp.Regexp
+}
+
+// pathMatcher matches slash-separated paths against an ordered list of
+// patterns. Like in .gitignore files, the last matching pattern wins and
+// everything below an ignored directory is ignored as well.
+type pathMatcher struct {
+	patterns []pathPattern
+}
+
+// newPathMatcher compiles the given patterns. When anchor is false, all
+// patterns match at any depth, which is what import path patterns need.
+func newPathMatcher(patterns []string, anchor bool) (*pathMatcher, error) {
+	m := &pathMatcher{}
+	for _, raw := range patterns {
+		var p pathPattern
+		pattern := strings.TrimSpace(raw)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if strings.HasPrefix(pattern, "!") {
+			p.negate = true
+			pattern = pattern[1:]
+		}
+
+		if strings.HasPrefix(pattern, "re:") {
+			re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", raw, err)
+			}
+			p.regex = re
+			m.patterns = append(m.patterns, p)
+			continue
+		}
+
+		pattern = strings.TrimPrefix(pattern, "./")
+		if strings.HasSuffix(pattern, "/") {
+			p.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+		anchored := anchor && strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("invalid pattern %q", raw)
+		}
+
+		p.elems = strings.Split(pattern, "/")
+		for _, elem := range p.elems {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", raw, err)
+			}
+		}
+		if !anchored && p.elems[0] != "**" {
+			p.elems = append([]string{"**"}, p.elems...)
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// match reports whether the slash-separated path, or one of its parent
+// directories, is ignored. isDir tells whether the path itself is a directory.
+func (m *pathMatcher) match(p string, isDir bool) bool {
+	if m == nil || len(m.patterns) == 0 {
+		return false
+	}
+	p = strings.Trim(p, "/")
+	if p == "" || p == "." {
+		return false
+	}
+
+	elems := strings.Split(p, "/")
+	for i := 1; i <= len(elems); i++ {
+		if m.matchElems(elems[:i], i < len(elems) || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchElems applies the patterns to a single path, without looking at
+// its parent directories.
+func (m *pathMatcher) matchElems(elems []string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		var matched bool
+		if p.regex != nil {
+			matched = p.regex.MatchString(strings.Join(elems, "/"))
+		} else {
+			matched = matchPathElems(p.elems, elems)
+		}
+		if matched {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matchPathElems matches path elements against pattern elements, where a
+// "**" pattern element matches zero or more path elements.
+func matchPathElems(pattern, elems []string) bool {
+	if len(pattern) == 0 {
+		return len(elems) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchPathElems(pattern[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+		return false
+	}
+	return matchPathElems(pattern[1:], elems[1:])
+}
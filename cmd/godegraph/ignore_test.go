@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestPathMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		anchor   bool
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		// Plain names match at any depth, along with everything below them
+		{[]string{"vendor"}, true, "vendor", true, true},
+		{[]string{"vendor"}, true, "a/vendor/b/c.go", false, true},
+		{[]string{"vendor"}, true, "vendors", true, false},
+
+		// Wildcards stay within a path element
+		{[]string{"*.pb.go"}, true, "api/v1/x.pb.go", false, true},
+		{[]string{"gen?"}, true, "gen1/x.go", false, true},
+		{[]string{"[ab]pi"}, true, "bpi", true, true},
+		{[]string{"a/*/c"}, true, "a/b/c", true, true},
+		{[]string{"a/*/c"}, true, "a/b/x/c", true, false},
+
+		// "**" spans any number of elements
+		{[]string{"a/**/c"}, true, "a/c", true, true},
+		{[]string{"a/**/c"}, true, "a/b/x/c", true, true},
+		{[]string{"**/mocks"}, true, "x/y/mocks/m.go", false, true},
+
+		// Inner and leading slashes anchor patterns at the root
+		{[]string{"/build"}, true, "build", true, true},
+		{[]string{"/build"}, true, "sub/build", true, false},
+		{[]string{"internal/gen"}, true, "x/internal/gen", true, false},
+		{[]string{"./scripts"}, true, "scripts", true, true},
+
+		// Import path patterns are never anchored
+		{[]string{"internal/gen"}, false, "example.com/x/internal/gen/y", true, true},
+
+		// Directory-only patterns
+		{[]string{"testdata/"}, true, "testdata", true, true},
+		{[]string{"testdata/"}, true, "testdata", false, false},
+		{[]string{"testdata/"}, true, "testdata/x.go", false, true},
+
+		// The last matching pattern wins, but not below ignored directories
+		{[]string{"*.go", "!keep.go"}, true, "a/keep.go", false, false},
+		{[]string{"*.go", "!keep.go"}, true, "a/drop.go", false, true},
+		{[]string{"vendor", "!vendor/keep"}, true, "vendor/keep", true, true},
+
+		// Regular expressions are searched in the whole path
+		{[]string{`re:_test\.go$`}, true, "a/b_test.go", false, true},
+		{[]string{`re:^cmd/(x|y)$`}, true, "cmd/y", true, true},
+		{[]string{`re:^cmd/(x|y)$`}, true, "cmd/z", true, false},
+
+		// Comments, blank lines and the root are never matched
+		{[]string{"# vendor", ""}, true, "# vendor", true, false},
+		{[]string{"*"}, true, ".", true, false},
+	}
+	for _, tt := range tests {
+		m, err := newPathMatcher(tt.patterns, tt.anchor)
+		if err != nil {
+			t.Fatalf("newPathMatcher(%q): %v", tt.patterns, err)
+		}
+		if got := m.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("patterns %q (anchor %v) match(%q, dir %v) = %v, want %v", tt.patterns, tt.anchor, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestPathMatcherErrors(t *testing.T) {
+	for _, pattern := range []string{"re:(", "[a", "/"} {
+		if _, err := newPathMatcher([]string{pattern}, true); err == nil {
+			t.Errorf("newPathMatcher(%q) succeeded, want error", pattern)
+		}
+	}
+	var m *pathMatcher
+	if m.match("a", true) {
+		t.Error("nil matcher matched")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// loadOptions controls how packages are loaded.
+type loadOptions struct {
+	jobs    int  // maximum number of concurrent "go list" processes
+	noCache bool // bypass the on-disk package cache
+
+	// Build configurations to load. Packages are loaded once per
+	// configuration and the results merged; with more than one, nodes and
+	// links are annotated with the configurations they appear in.
+	configs []buildConfig
+}
+
+// buildConfig is a GOOS/GOARCH/build tags combination. Empty fields use
+// the environment's defaults.
+type buildConfig struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+// parseBuildConfig parses "goos/goarch:tag1,tag2". All parts are
+// optional, e.g. "windows", "linux/arm64" or ":integration".
+func parseBuildConfig(value string) (buildConfig, error) {
+	var cfg buildConfig
+	platform, tags, _ := strings.Cut(value, ":")
+	cfg.GOOS, cfg.GOARCH, _ = strings.Cut(platform, "/")
+	cfg.Tags = splitList(tags)
+	if strings.Contains(cfg.GOARCH, "/") {
+		return cfg, fmt.Errorf("invalid build configuration %q, expected goos/goarch:tags", value)
+	}
+	if cfg.GOOS == "" && cfg.GOARCH == "" && len(cfg.Tags) == 0 {
+		return cfg, fmt.Errorf("empty build configuration %q", value)
+	}
+	return cfg, nil
+}
+
+// String returns the configuration in the syntax of parseBuildConfig.
+func (c buildConfig) String() string {
+	s := c.GOOS
+	if c.GOARCH != "" {
+		s += "/" + c.GOARCH
+	}
+	if len(c.Tags) > 0 {
+		s += ":" + strings.Join(c.Tags, ",")
+	}
+	if s == "" {
+		return "default"
+	}
+	return s
+}
+
+// env returns the environment of "go list" for the configuration.
+func (c buildConfig) env() []string {
+	var env []string
+	if c.GOOS != "" {
+		env = append(env, "GOOS="+c.GOOS)
+	}
+	if c.GOARCH != "" {
+		env = append(env, "GOARCH="+c.GOARCH)
+	}
+	return env
+}
+
+// buildConfigList collects repeated -matrix flags.
+type buildConfigList []buildConfig
+
+func (l *buildConfigList) String() string {
+	var items []string
+	for _, cfg := range *l {
+		items = append(items, cfg.String())
+	}
+	return strings.Join(items, " ")
+}
+
+func (l *buildConfigList) Set(value string) error {
+	cfg, err := parseBuildConfig(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, cfg)
+	return nil
+}
+
+// moduleResult holds the packages loaded for one module.
+type moduleResult struct {
+	packages []Package
+	err      error
+}
+
+// loadPackages runs "go list" for each build configuration and module
+// using at most opts.jobs concurrent processes. The packages are returned
+// indexed by configuration and module, so the result does not depend on
+// which module finishes first.
+func loadPackages(modules []ModuleInfo, opts loadOptions) [][][]Package {
+	jobs := opts.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	configs := opts.configs
+	if len(configs) == 0 {
+		configs = []buildConfig{{}}
+	}
+
+	type task struct{ config, module int }
+	results := make([][]moduleResult, len(configs))
+	for c := range results {
+		results[c] = make([]moduleResult, len(modules))
+	}
+
+	tasks := make(chan task)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(modules)*len(configs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				packages, err := loadModulePackages(modules[t.module].Dir, configs[t.config], opts)
+				results[t.config][t.module] = moduleResult{packages: packages, err: err}
+			}
+		}()
+	}
+	for c := range configs {
+		for m := range modules {
+			tasks <- task{config: c, module: m}
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	packages := make([][][]Package, len(configs))
+	for c := range configs {
+		packages[c] = make([][]Package, len(modules))
+		for m, result := range results[c] {
+			if result.err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to list packages in %s (%s): %v\n", modules[m].Dir, configs[c], result.err)
+			}
+			packages[c][m] = result.packages
+		}
+	}
+	return packages
+}
+
+// goListArgs returns the arguments of the "go list" invocation.
+func goListArgs(cfg buildConfig) []string {
+	args := []string{"list", "-json"}
+	if len(cfg.Tags) > 0 {
+		args = append(args, "-tags="+strings.Join(cfg.Tags, ","))
+	}
+	return append(args, "./...")
+}
+
+// loadModulePackages returns the packages of the module in dir, from the
+// cache if the module did not change since it was last listed.
+func loadModulePackages(dir string, cfg buildConfig, opts loadOptions) ([]Package, error) {
+	args := goListArgs(cfg)
+	env := cfg.env()
+	if opts.noCache {
+		fmt.Fprintf(os.Stderr, "Processing module in directory: %s (%s)\n", dir, cfg)
+		return listModulePackages(dir, args, env)
+	}
+
+	key, err := moduleCacheKey(dir, args, env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to compute cache key for %s: %v\n", dir, err)
+		return listModulePackages(dir, args, env)
+	}
+	if packages, ok := readCachedPackages(key); ok {
+		fmt.Fprintf(os.Stderr, "Using cached packages for module in directory: %s (%s)\n", dir, cfg)
+		return packages, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Processing module in directory: %s (%s)\n", dir, cfg)
+	packages, err := listModulePackages(dir, args, env)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCachedPackages(key, packages); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache packages of %s: %v\n", dir, err)
+	}
+	return packages, nil
+}
+
+// listModulePackages runs "go list" in dir with the extra environment
+// variables and decodes its output while it is being produced.
+func listModulePackages(dir string, args []string, env []string) ([]Package, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	var decodeErr error
+	decoder := json.NewDecoder(stdout)
+	for decoder.More() {
+		var pkg Package
+		if err := decoder.Decode(&pkg); err != nil {
+			decodeErr = fmt.Errorf("failed to decode package: %v", err)
+			// Drain the pipe so that the process can exit
+			io.Copy(io.Discard, stdout)
+			break
+		}
+		packages = append(packages, pkg)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return packages, decodeErr
+}
+
+// runGo runs the go command in dir with the extra environment variables
+// and returns its output.
+func runGo(dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseBuildConfig(t *testing.T) {
+	tests := []struct {
+		value string
+		want  buildConfig
+		str   string
+	}{
+		{"windows", buildConfig{GOOS: "windows"}, "windows"},
+		{"linux/arm64", buildConfig{GOOS: "linux", GOARCH: "arm64"}, "linux/arm64"},
+		{"/386", buildConfig{GOARCH: "386"}, "/386"},
+		{":integration", buildConfig{Tags: []string{"integration"}}, ":integration"},
+		{"darwin/amd64:cgo, netgo", buildConfig{GOOS: "darwin", GOARCH: "amd64", Tags: []string{"cgo", "netgo"}}, "darwin/amd64:cgo,netgo"},
+	}
+	for _, tt := range tests {
+		got, err := parseBuildConfig(tt.value)
+		if err != nil {
+			t.Errorf("parseBuildConfig(%q): %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseBuildConfig(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+		if s := got.String(); s != tt.str {
+			t.Errorf("parseBuildConfig(%q).String() = %q, want %q", tt.value, s, tt.str)
+		}
+		if again, err := parseBuildConfig(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("parseBuildConfig(%q) does not round trip: %+v, %v", got.String(), again, err)
+		}
+	}
+
+	for _, value := range []string{"", ":", "/", "linux/amd64/v3"} {
+		if cfg, err := parseBuildConfig(value); err == nil {
+			t.Errorf("parseBuildConfig(%q) = %+v, want an error", value, cfg)
+		}
+	}
+	if s := (buildConfig{}).String(); s != "default" {
+		t.Errorf("String() of the default configuration = %q", s)
+	}
+}
+
+func TestBuildConfigCommand(t *testing.T) {
+	cfg := buildConfig{GOOS: "linux", Tags: []string{"a", "b"}}
+	if env := cfg.env(); !reflect.DeepEqual(env, []string{"GOOS=linux"}) {
+		t.Errorf("env() = %q", env)
+	}
+	if args := goListArgs(cfg); !reflect.DeepEqual(args, []string{"list", "-json", "-tags=a,b", "./..."}) {
+		t.Errorf("goListArgs() = %q", args)
+	}
+	if args := goListArgs(buildConfig{}); !reflect.DeepEqual(args, []string{"list", "-json", "./..."}) {
+		t.Errorf("goListArgs() of the default configuration = %q", args)
+	}
+}
+
+func TestBuildConfigList(t *testing.T) {
+	var list buildConfigList
+	for _, value := range []string{"linux", "windows/amd64:integration"} {
+		if err := list.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := list.String(); got != "linux windows/amd64:integration" {
+		t.Errorf("String() = %q", got)
+	}
+	if err := list.Set(""); err == nil || len(list) != 2 {
+		t.Errorf("Set(\"\") = %v, list %v", err, list)
+	}
+}
+
+func TestLoadPackages(t *testing.T) {
+	modules := writeTypedTestModules(t)
+	modules = append(modules, ModuleInfo{ModulePath: "example.com/missing", Dir: filepath.Join(modules[0].Dir, "missing")})
+	configs := []buildConfig{{GOOS: "linux"}, {GOOS: "windows"}}
+	want := [][][]string{
+		{{"example.com/m/app", "example.com/m/cmd", "example.com/m/lib"}, {"example.com/m/tools/plugin"}, nil},
+		{{"example.com/m/app", "example.com/m/cmd", "example.com/m/lib", "example.com/m/winsvc"}, {"example.com/m/tools/plugin"}, nil},
+	}
+
+	// Results are indexed by configuration and module, however many
+	// modules are listed at once
+	for _, jobs := range []int{0, 1, 8} {
+		result := loadPackages(modules, loadOptions{jobs: jobs, noCache: true, configs: configs})
+		got := make([][][]string, len(result))
+		for c := range result {
+			got[c] = make([][]string, len(result[c]))
+			for m, packages := range result[c] {
+				for _, pkg := range packages {
+					got[c][m] = append(got[c][m], pkg.ImportPath)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("loadPackages() with %d jobs = %q, want %q", jobs, got, want)
+		}
+	}
+}
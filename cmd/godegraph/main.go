@@ -1,43 +1,39 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
 var (
-	// Add paths to ignore relative to root directory
-	ignoredPaths []string
+	// Gitignore-style patterns of paths to ignore, relative to root directory
+	ignoredPaths *pathMatcher
+	// Gitignore-style patterns of import paths to exclude
+	excludedImportPaths *pathMatcher
 )
 
 // shouldIgnorePath checks if the given path should be ignored
-func shouldIgnorePath(path string, rootDir string) bool {
+func shouldIgnorePath(path string, rootDir string, isDir bool) bool {
 	// Get relative path from root directory
 	relPath, err := filepath.Rel(rootDir, path)
 	if err != nil {
 		return false
 	}
 
-	// Check if path matches any ignored path
-	for _, ignorePath := range ignoredPaths {
-		// Convert both paths to use forward slashes for consistent comparison
-		ignorePath = filepath.ToSlash(ignorePath)
-		relPath = filepath.ToSlash(relPath)
+	// Convert to forward slashes for consistent comparison
+	return ignoredPaths.match(filepath.ToSlash(relPath), isDir)
+}
 
-		if strings.HasPrefix(relPath, ignorePath) {
-			return true
-		}
-	}
-	return false
+// shouldExcludePackage checks if the given import path should be excluded
+func shouldExcludePackage(importPath string) bool {
+	return excludedImportPaths.match(importPath, true)
 }
 
 const htmlTemplate = `
@@ -147,6 +143,7 @@ const htmlTemplate = `
             font-size: 12px;
             box-shadow: 0 2px 4px rgba(0,0,0,0.1);
             max-width: 500px;
+            z-index: 2000;
         }
         .tooltip-title {
             font-weight: bold;
@@ -156,6 +153,31 @@ const htmlTemplate = `
             color: #666;
             margin-bottom: 8px;
         }
+        .tooltip-configs {
+            color: #888;
+            font-size: 11px;
+        }
+        .tooltip-symbols {
+            color: #888;
+            font-size: 11px;
+            font-family: monospace;
+        }
+        .tooltip-diagnostic {
+            color: #c0392b;
+            margin-bottom: 8px;
+        }
+        .node.interface circle {
+            fill-opacity: 0.35;
+        }
+        .package-cluster {
+            fill-opacity: 0.08;
+            stroke-opacity: 0.4;
+            stroke-width: 1px;
+        }
+        .node.has-diagnostics circle {
+            stroke: #c0392b;
+            stroke-dasharray: 2, 2;
+        }
         .tooltip-section {
             margin-top: 8px;
         }
@@ -198,6 +220,104 @@ const htmlTemplate = `
         .legend-text {
             font-size: 12px;
         }
+        #queryInput {
+            width: 360px;
+            padding: 5px;
+            margin-left: 10px;
+            border: 1px solid #ccc;
+            border-radius: 3px;
+            font-family: monospace;
+        }
+        #queryError {
+            display: block;
+            margin-top: 5px;
+            color: #c0392b;
+            font-size: 12px;
+        }
+        .filtered-out {
+            display: none;
+        }
+        .node.critical circle {
+            stroke: #8e44ad;
+            stroke-width: 4px;
+        }
+        .dependency-link.critical {
+            stroke: #8e44ad;
+            stroke-opacity: 0.8;
+            stroke-width: 3px;
+            fill: none;
+        }
+        .panel {
+            position: fixed;
+            top: 60px;
+            left: 10px;
+            right: 10px;
+            bottom: 10px;
+            z-index: 1500;
+            overflow: auto;
+            background-color: white;
+            border-radius: 5px;
+            box-shadow: 0 2px 5px rgba(0,0,0,0.2);
+            display: none;
+        }
+        .coupling-ribbon {
+            fill-opacity: 0.6;
+            cursor: pointer;
+        }
+        .coupling-ribbon:hover, .coupling-ribbon.active {
+            fill-opacity: 0.95;
+        }
+        .component-link {
+            fill: none;
+            stroke: #999;
+            stroke-opacity: 0.6;
+        }
+        .component-node {
+            cursor: pointer;
+        }
+        .component-node text {
+            font-size: 11px;
+            fill: #333;
+        }
+        #couplingImports {
+            position: absolute;
+            top: 50px;
+            right: 10px;
+            width: 40%;
+            font-size: 12px;
+        }
+        .dsm-label {
+            font-size: 10px;
+            fill: #444;
+            cursor: pointer;
+        }
+        .dsm-label:hover {
+            fill: #ff0000;
+        }
+        .dsm-cell {
+            cursor: pointer;
+        }
+        #reachPanel {
+            margin-top: 10px;
+            display: none;
+        }
+        .reach-table {
+            font-size: 12px;
+            border-collapse: collapse;
+        }
+        .reach-table th, .reach-table td {
+            padding: 2px 6px;
+            text-align: right;
+        }
+        .reach-table th:first-child, .reach-table td:first-child {
+            text-align: left;
+        }
+        #criticalPathList {
+            margin: 4px 0 0 0;
+            padding-left: 20px;
+            font-size: 11px;
+            color: #666;
+        }
     </style>
 </head>
 <body>
@@ -205,6 +325,39 @@ const htmlTemplate = `
         <button id="toggleOutgoing" class="toggle-btn active">Imports</button>
         <button id="toggleIncoming" class="toggle-btn active">Imported by</button>
         <button id="toggleCrossModule" class="toggle-btn">Cross-module only</button>
+        <label class="toggle-btn" title="Levels of dependencies and dependents highlighted for the selection">
+            Depth <input id="depthSlider" type="range" min="1" max="11" step="1" style="vertical-align: middle;">
+            <span id="depthValue"></span>
+        </label>
+        <button id="toggleCriticalPath" class="toggle-btn" style="display: none;">Critical path</button>
+        <button id="toggleDSM" class="toggle-btn">Matrix</button>
+        <button id="toggleCoupling" class="toggle-btn">Module coupling</button>
+        <button id="toggleComponents" class="toggle-btn" style="display: none;">Components</button>
+        <button id="exportSVG" class="toggle-btn" title="Download the graph as displayed">Export SVG</button>
+        <button id="exportPNG" class="toggle-btn" title="Download the graph as displayed">Export PNG</button>
+        <select id="colorBy" class="toggle-btn">
+            <option value="module">Color by module</option>
+            <option value="coverage">Color by coverage</option>
+            <option value="churn">Color by churn</option>
+            <option value="owner">Color by owner</option>
+            <option value="profile">Color by profile</option>
+            <option value="binarySize">Color by binary size</option>
+            <option value="buildTime">Color by compile time</option>
+        </select>
+        <select id="sizeBy" class="toggle-btn">
+            <option value="">Fixed size</option>
+            <option value="files">Size by files</option>
+            <option value="lines">Size by lines of code</option>
+            <option value="exported">Size by exported identifiers</option>
+            <option value="testFiles">Size by test files</option>
+            <option value="complexity">Size by complexity</option>
+            <option value="binarySize">Size by binary size</option>
+            <option value="buildTime">Size by compile time</option>
+        </select>
+        <input id="queryInput" type="text" placeholder="Query, e.g. deps(example.com/api/...) - module(legacy)">
+        <button id="applyQuery" class="toggle-btn">Filter</button>
+        <button id="clearQuery" class="toggle-btn">Clear</button>
+        <span id="queryError"></span>
     </div>
     <div class="legend">
         <div class="legend-title">Legend</div>
@@ -220,6 +373,46 @@ const htmlTemplate = `
             <div class="legend-line" style="background: #1f77b4; opacity: 0.4;"></div>
             <span class="legend-text">Incoming Dependencies</span>
         </div>
+        <div class="legend-item legend-calls" style="display: none;">
+            <div class="legend-line" style="background: #27ae60; opacity: 0.6; height: 5px;"></div>
+            <span class="legend-text">Calls (width by call sites)</span>
+        </div>
+        <div class="legend-item legend-calls" style="display: none;">
+            <div class="legend-line" style="border-top: 2px dotted #27ae60; height: 0;"></div>
+            <span class="legend-text">Import without calls</span>
+        </div>
+        <div class="legend-item" id="legendCoverage" style="display: none;">
+            <div class="legend-line" style="background: linear-gradient(to right, #a50026, #ffffbf, #006837); height: 8px;"></div>
+            <span class="legend-text">Coverage 0% to 100%</span>
+        </div>
+        <div class="legend-item" id="legendChurn" style="display: none;">
+            <div class="legend-line" style="background: linear-gradient(to right, #ffeda0, #fd8d3c, #800026); height: 8px;"></div>
+            <span class="legend-text">Commits, few to many</span>
+        </div>
+        <div id="legendOwners" style="display: none;"></div>
+        <div class="legend-item" id="legendProfile" style="display: none;">
+            <div class="legend-line" style="background: linear-gradient(to right, #fcfdbf, #fc8961, #b73779, #000004); height: 8px;"></div>
+            <span class="legend-text">Cumulative samples, few to many</span>
+        </div>
+        <div class="legend-item" id="legendBinarySize" style="display: none;">
+            <div class="legend-line" style="background: linear-gradient(to right, #f7fbff, #6baed6, #08306b); height: 8px;"></div>
+            <span class="legend-text">Cumulative binary size, small to large</span>
+        </div>
+        <div class="legend-item" id="legendBuildTime" style="display: none;">
+            <div class="legend-line" style="background: linear-gradient(to right, #fff5eb, #fd8d3c, #7f2704); height: 8px;"></div>
+            <span class="legend-text">Compile time, short to long</span>
+        </div>
+        <div id="legendCriticalPath" style="display: none;">
+            <div class="legend-item">
+                <div class="legend-line" style="background: #8e44ad; height: 3px;"></div>
+                <span class="legend-text" id="criticalPathTitle">Critical path</span>
+            </div>
+            <ol id="criticalPathList"></ol>
+        </div>
+        <div class="legend-item" id="legendImplements" style="display: none;">
+            <div class="legend-line" style="border-top: 2px dashed #27ae60; height: 0;"></div>
+            <span class="legend-text">Implements</span>
+        </div>
         <div class="legend-item">
             <div class="legend-circle" style="border-color: #ff0000;"></div>
             <span class="legend-text">Selected Node</span>
@@ -232,15 +425,124 @@ const htmlTemplate = `
             <div class="legend-circle" style="border-color: #1f77b4;"></div>
             <span class="legend-text">Importing Node</span>
         </div>
+        <div class="legend-item">
+            <div class="legend-line" style="background: linear-gradient(to right, #ff7f0e, #d8d8d8); height: 4px;"></div>
+            <span class="legend-text">Farther away, with depth above 1</span>
+        </div>
+        <div id="reachPanel"></div>
     </div>
+    <div id="dsmPanel" class="panel"></div>
+    <div id="couplingPanel" class="panel"></div>
+    <div id="componentsPanel" class="panel"></div>
     <div id="tooltip" class="tooltip" style="display: none;"></div>
     <script>
         // Parse the JSON data from the template
         const data = JSON.parse({{.}});
-        let showIncoming = true;
-        let showOutgoing = true;
-        let showCrossModuleOnly = false;
+        const viewerOptions = data.viewer || {};
+        let showIncoming = viewerOptions.showImportedBy !== false;
+        let showOutgoing = viewerOptions.showImports !== false;
+        let showCrossModuleOnly = !!viewerOptions.crossModuleOnly;
+        let showCriticalPath = !!viewerOptions.criticalPath && !!data.build;
         let selectedNodeIds = new Set();
+        let queryVisibleIds = null;  // ids of hierarchy nodes matching the query, null when unfiltered
+
+        // Type graphs have named types as nodes, grouped by package
+        const isTypeGraph = data.nodes.some(n => n.package);
+        const outgoingLabel = isTypeGraph ? "Depends on" : "Imports";
+        const incomingLabel = isTypeGraph ? "Used by" : "Imported by";
+
+        // Package nodes can be sized by one of their metrics, relative to the
+        // largest value in the graph
+        let sizeBy = viewerOptions.sizeBy || "";
+        function metricValue(node, metric) {
+            if (metric === "binarySize") return node.binarySize ? node.binarySize.cumulative : 0;
+            if (metric === "buildTime") return node.buildTime ? node.buildTime.duration : 0;
+            return node.metrics ? node.metrics[metric] || 0 : 0;
+        }
+
+        const metricMax = new Map();
+        Array.from(document.querySelectorAll("#sizeBy option")).map(o => o.value).filter(m => m).forEach(metric => {
+            metricMax.set(metric, d3.max(data.nodes, node => metricValue(node, metric)) || 0);
+        });
+
+        function nodeRadius(d) {
+            if (sizeBy && d.data.isPackage) {
+                const max = metricMax.get(sizeBy) || 0;
+                return max > 0 ? 3 + 11 * Math.sqrt(metricValue(d.data, sizeBy) / max) : 3;
+            }
+            if (d.data.id === d.data.module) return 8;
+            if (d.data.isPackage) return 6;
+            return 4;
+        }
+
+        // Links by "source\ntarget", for the details shown in tooltips
+        const linksByKey = new Map();
+        data.links.forEach(link => linksByKey.set(link.source + "\n" + link.target, link));
+
+        function linkDetails(source, target) {
+            const link = linksByKey.get(source + "\n" + target);
+            if (!link) return '';
+            let details = '';
+            if (link.kinds) {
+                details += ' <span class="tooltip-configs">(' + link.kinds.join(", ") + ')</span>';
+            }
+            if (data.callGraph) {
+                const calls = link.calls || 0;
+                details += ' <span class="tooltip-configs">' + calls + ' call site' + (calls === 1 ? '' : 's') + '</span>';
+            }
+            if (link.critical) {
+                details += ' <span class="tooltip-configs">(critical path)</span>';
+            }
+            if (link.samples) {
+                details += ' <span class="tooltip-configs">' + formatShare(link.samples) + ' of ' + data.profile.sampleType + '</span>';
+            }
+            if (link.configs) {
+                details += ' <span class="tooltip-configs">[' + link.configs.join(", ") + ']</span>';
+            }
+            if (link.symbols) {
+                details += '<div class="tooltip-symbols">' + link.symbols.length + ' symbol' +
+                    (link.symbols.length === 1 ? '' : 's') + ': ' +
+                    link.symbols.map(sym => sym.name + (sym.count > 1 ? ' ×' + sym.count : '')).join(", ") +
+                    '</div>';
+            }
+            return details;
+        }
+
+        // Links that only stand for interface implementations are dashed, and
+        // with a call graph, imports without calls are dotted
+        function linkDash(source, target) {
+            const link = linksByKey.get(source + "\n" + target);
+            if (!link) return null;
+            if (link.kinds && link.kinds.length === 1 && link.kinds[0] === "implements") return "4,3";
+            if (data.callGraph && !link.calls) return "1,3";
+            return null;
+        }
+
+        // Links get wider with their share of the profile samples or, with a
+        // call graph, with the number of call sites
+        function linkWidth(source, target) {
+            const link = linksByKey.get(source + "\n" + target);
+            if (!link) return "1.5px";
+            if (data.profile && data.profile.total > 0 && link.samples) {
+                return 1.5 + 6.5 * Math.sqrt(link.samples / data.profile.total) + "px";
+            }
+            if (!data.callGraph || !link.calls) return "1.5px";
+            return Math.min(1.5 + Math.log2(1 + link.calls), 8) + "px";
+        }
+
+        function formatBytes(n) {
+            if (n >= 1 << 20) return (n / (1 << 20)).toFixed(1) + ' MB';
+            if (n >= 1 << 10) return (n / (1 << 10)).toFixed(1) + ' KB';
+            return n + ' B';
+        }
+
+        function formatMillis(ms) {
+            return ms >= 1000 ? (ms / 1000).toFixed(2) + ' s' : ms.toFixed(0) + ' ms';
+        }
+
+        function formatShare(value) {
+            return (100 * value / data.profile.total).toFixed(1) + '%';
+        }
 
         function createHierarchy(data) {
             // Create nodes map first
@@ -248,8 +550,20 @@ const htmlTemplate = `
             data.nodes.forEach(node => {
                 nodesMap.set(node.id, {
                     id: node.id,
-                    name: node.id.split("/").pop(),
+                    name: node.package ? node.id.slice(node.package.length + 1) : node.id.split("/").pop(),
                     module: node.module,
+                    package: node.package,
+                    kind: node.kind,
+                    diagnostics: node.diagnostics || [],
+                    configs: node.configs,
+                    metrics: node.metrics,
+                    coverage: node.coverage,
+                    churn: node.churn,
+                    owners: node.owners,
+                    samples: node.samples,
+                    binarySize: node.binarySize,
+                    buildTime: node.buildTime,
+                    component: node.component,
                     isPackage: true,
                     children: []
                 });
@@ -263,7 +577,8 @@ const htmlTemplate = `
             };
 
             data.nodes.forEach(node => {
-                const parts = node.id.split("/");
+                // Types are placed below their package
+                const parts = node.package ? node.package.split("/").concat([nodesMap.get(node.id).name]) : node.id.split("/");
                 let currentPath = "";
                 let parent = root;
 
@@ -274,8 +589,8 @@ const htmlTemplate = `
                     
                     let currentNode;
                     if (index === parts.length - 1) {
-                        // This is a package node
-                        currentNode = nodesMap.get(currentPath);
+                        // This is a package node, or a type node in type graphs
+                        currentNode = nodesMap.get(node.id);
                     } else {
                         // This is a folder node
                         if (!nodesMap.has(currentPath)) {
@@ -293,13 +608,20 @@ const htmlTemplate = `
                     }
 
                     // Add to parent if not already there
-                    if (!parent.children.find(child => child.id === currentNode.id)) {
+                    if (!parent.childIds) parent.childIds = new Set();
+                    if (!parent.childIds.has(currentNode.id)) {
+                        parent.childIds.add(currentNode.id);
                         parent.children.push(currentNode);
                     }
                     parent = currentNode;
                 });
             });
 
+            // Mark the packages whose types are clustered
+            data.nodes.forEach(node => {
+                if (node.package && nodesMap.has(node.package)) nodesMap.get(node.package).cluster = true;
+            });
+
             // Add imports information
             data.links.forEach(link => {
                 const source = nodesMap.get(link.source);
@@ -315,6 +637,190 @@ const htmlTemplate = `
             return root;
         }
 
+        // Query language, mirroring the "godegraph query" subcommand
+        function tokenizeQuery(input) {
+            const tokens = [];
+            const isWordChar = c => /[\p{L}\p{Nd}\/._*~@-]/u.test(c);
+            let i = 0;
+            while (i < input.length) {
+                const c = input[i];
+                if (/\s/.test(c)) {
+                    i++;
+                } else if ("()+|-&,".includes(c)) {
+                    tokens.push({kind: "op", text: c, pos: i});
+                    i++;
+                } else if (c === '"' || c === "'") {
+                    const end = input.indexOf(c, i + 1);
+                    if (end < 0) throw new Error("unterminated string at position " + i);
+                    tokens.push({kind: "word", text: input.slice(i + 1, end), pos: i});
+                    i = end + 1;
+                } else if (isWordChar(c)) {
+                    const start = i;
+                    while (i < input.length && isWordChar(input[i])) i++;
+                    tokens.push({kind: "word", text: input.slice(start, i), pos: start});
+                } else {
+                    throw new Error("unexpected character '" + c + "' at position " + i);
+                }
+            }
+            tokens.push({kind: "eof", text: "", pos: input.length});
+            return tokens;
+        }
+
+        const queryFunctions = {
+            deps: {sets: 1, hasDepth: true},
+            rdeps: {sets: 1, hasDepth: true},
+            imports: {sets: 1},
+            module: {sets: 1},
+            allpaths: {sets: 2}
+        };
+
+        function parseQuery(input) {
+            const tokens = tokenizeQuery(input);
+            let pos = 0;
+            const peek = () => tokens[pos];
+            const next = () => tokens[pos].kind === "eof" ? tokens[pos] : tokens[pos++];
+            const isOp = (tok, ops) => tok.kind === "op" && ops.includes(tok.text);
+            const expect = op => {
+                const tok = next();
+                if (isOp(tok, [op])) return;
+                if (tok.kind === "eof") throw new Error("expected " + JSON.stringify(op) + " at end of query");
+                throw new Error("expected " + JSON.stringify(op) + " at position " + tok.pos + ", found " + JSON.stringify(tok.text));
+            };
+
+            function parseExpr() {
+                let left = parseTerm();
+                while (isOp(peek(), ["+", "|", "-"])) {
+                    const op = next().text;
+                    left = {op: op, left: left, right: parseTerm()};
+                }
+                return left;
+            }
+            function parseTerm() {
+                let left = parseFactor();
+                while (isOp(peek(), ["&"])) {
+                    next();
+                    left = {op: "&", left: left, right: parseFactor()};
+                }
+                return left;
+            }
+            function parseFactor() {
+                const tok = next();
+                if (isOp(tok, ["("])) {
+                    const expr = parseExpr();
+                    expect(")");
+                    return expr;
+                }
+                if (tok.kind === "word") {
+                    if (isOp(peek(), ["("])) return parseCall(tok);
+                    return {pattern: tok.text};
+                }
+                if (tok.kind === "eof") throw new Error("unexpected end of query");
+                throw new Error("unexpected " + JSON.stringify(tok.text) + " at position " + tok.pos);
+            }
+            function parseCall(name) {
+                const fn = queryFunctions[name.text];
+                if (!fn) throw new Error("unknown function " + JSON.stringify(name.text) + " at position " + name.pos);
+                next();
+                const call = {call: name.text, args: [], depth: -1};
+                for (let i = 0; i < fn.sets; i++) {
+                    if (i > 0) expect(",");
+                    call.args.push(parseExpr());
+                }
+                if (fn.hasDepth && isOp(peek(), [","])) {
+                    next();
+                    const tok = next();
+                    if (tok.kind !== "word" || !/^[0-9]+$/.test(tok.text)) {
+                        throw new Error(name.text + "(): invalid depth " + JSON.stringify(tok.text) + " at position " + tok.pos);
+                    }
+                    const depth = Number(tok.text);
+                    call.depth = depth;
+                }
+                expect(")");
+                return call;
+            }
+
+            const expr = parseExpr();
+            if (peek().kind !== "eof") throw new Error("unexpected " + JSON.stringify(peek().text) + " at position " + peek().pos);
+            return expr;
+        }
+
+        function matchPattern(pattern) {
+            let re = pattern.replace(/[.*+?^${}()|[\]\\]/g, "\\$&")
+                .split("\\.\\.\\.").join(".*")
+                .split("\\*").join("[^/]*");
+            if (re.endsWith("/.*")) re = re.slice(0, -3) + "(/.*)?";
+            const compiled = new RegExp("^" + re + "$");
+            return s => compiled.test(s);
+        }
+
+        function evaluateQuery(expr, data) {
+            const imports = new Map();
+            const importedBy = new Map();
+            data.links.forEach(link => {
+                if (!imports.has(link.source)) imports.set(link.source, []);
+                if (!importedBy.has(link.target)) importedBy.set(link.target, []);
+                imports.get(link.source).push(link.target);
+                importedBy.get(link.target).push(link.source);
+            });
+
+            function reach(start, edges, depth) {
+                const result = new Set(start);
+                let frontier = Array.from(start);
+                for (let level = 0; frontier.length > 0 && (depth < 0 || level < depth); level++) {
+                    const nextFrontier = [];
+                    frontier.forEach(id => {
+                        (edges.get(id) || []).forEach(neighbor => {
+                            if (!result.has(neighbor)) {
+                                result.add(neighbor);
+                                nextFrontier.push(neighbor);
+                            }
+                        });
+                    });
+                    frontier = nextFrontier;
+                }
+                return result;
+            }
+
+            function evaluate(e) {
+                if (e.pattern !== undefined) {
+                    const match = matchPattern(e.pattern);
+                    return new Set(data.nodes.filter(n => match(n.id)).map(n => n.id));
+                }
+                if (e.op) {
+                    const left = evaluate(e.left);
+                    const right = evaluate(e.right);
+                    if (e.op === "-") return new Set([...left].filter(id => !right.has(id)));
+                    if (e.op === "&") return new Set([...left].filter(id => right.has(id)));
+                    return new Set([...left, ...right]);
+                }
+                if (e.call === "module") {
+                    if (e.args[0].pattern === undefined) throw new Error("module() expects a module pattern");
+                    const match = matchPattern(e.args[0].pattern);
+                    const modules = new Set(data.modules
+                        .filter(m => match(m.modulePath) || match(m.name) || match(m.path))
+                        .map(m => m.modulePath));
+                    return new Set(data.nodes.filter(n => modules.has(n.module)).map(n => n.id));
+                }
+                const args = e.args.map(evaluate);
+                switch (e.call) {
+                    case "deps": return reach(args[0], imports, e.depth);
+                    case "rdeps": return reach(args[0], importedBy, e.depth);
+                    case "imports": {
+                        const result = new Set();
+                        args[0].forEach(id => (importedBy.get(id) || []).forEach(src => result.add(src)));
+                        return result;
+                    }
+                    case "allpaths": {
+                        const to = reach(args[1], importedBy, -1);
+                        return new Set([...reach(args[0], imports, -1)].filter(id => to.has(id)));
+                    }
+                }
+                throw new Error("unknown function " + JSON.stringify(e.call));
+            }
+
+            return evaluate(expr);
+        }
+
         // Create the hierarchy
         const hierarchyData = createHierarchy(data);
         const root = d3.hierarchy(hierarchyData);
@@ -345,16 +851,88 @@ const htmlTemplate = `
 
         treeLayout(root);
 
+        // Hierarchy nodes by id, for lookups in event handlers
+        const nodeById = new Map(root.descendants().map(d => [d.data.id, d]));
+
         // Initialize module colors
         const moduleColors = new Map();
         data.modules.forEach(module => {
             moduleColors.set(module.modulePath, module.color);
         });
 
+        // Nodes are colored by module, or by a value of their package; only
+        // the colorings for which there is data are offered
+        const colorByOptions = {
+            coverage: data.nodes.some(n => n.coverage),
+            churn: data.nodes.some(n => n.churn),
+            owner: data.nodes.some(n => n.owners),
+            profile: !!data.profile,
+            binarySize: !!data.binary,
+            buildTime: !!data.build
+        };
+        let colorBy = viewerOptions.colorBy || "module";
+        if (colorByOptions[colorBy] === false) colorBy = "module";
+
+        const maxBuildTime = d3.max(data.nodes, n => n.buildTime ? n.buildTime.duration : 0) || 1;
+        const maxCommits = d3.max(data.nodes, n => n.churn ? n.churn.commits : 0) || 1;
+        function ownerKey(node) {
+            return node.data.owners ? node.data.owners.join(" ") : "";
+        }
+        const ownerColors = new Map();
+        Array.from(new Set(data.nodes.filter(n => n.owners).map(n => n.owners.join(" ")))).sort()
+            .forEach((owners, i) => ownerColors.set(owners, d3.schemeTableau10[i % 10]));
+
+        function packageColor(d) {
+            if (colorBy === "coverage") {
+                if (!d.data.isPackage) return null;
+                if (!d.data.coverage) return "#ccc";
+                return d3.interpolateRdYlGn(d.data.coverage.percent / 100);
+            }
+            if (colorBy === "churn") {
+                if (!d.data.isPackage) return null;
+                if (!d.data.churn) return "#eee";
+                return d3.interpolateYlOrRd(0.15 + 0.85 * Math.sqrt(d.data.churn.commits / maxCommits));
+            }
+            if (colorBy === "profile") {
+                if (!d.data.isPackage) return null;
+                if (!d.data.samples || !data.profile.total) return "#eee";
+                return d3.interpolateMagma(1 - 0.9 * Math.sqrt(d.data.samples.cum / data.profile.total));
+            }
+            if (colorBy === "binarySize") {
+                if (!d.data.isPackage) return null;
+                if (!d.data.binarySize || !data.binary.total) return "#eee";
+                return d3.interpolateBlues(0.1 + 0.9 * Math.sqrt(d.data.binarySize.cumulative / data.binary.total));
+            }
+            if (colorBy === "buildTime") {
+                if (!d.data.isPackage) return null;
+                if (!d.data.buildTime) return "#eee";
+                return d3.interpolateOranges(0.1 + 0.9 * Math.sqrt(d.data.buildTime.duration / maxBuildTime));
+            }
+            if (colorBy === "owner") {
+                if (!d.data.isPackage) return null;
+                return ownerColors.get(ownerKey(d)) || "#ccc";
+            }
+            return moduleColors.get(d.data.module);
+        }
+
+        function nodeFill(d) {
+            if (!d.data || !d.data.module) return "#f8f9fa";
+            return packageColor(d) || "#f8f9fa";
+        }
+
+        function nodeStroke(d) {
+            if (!d.data || !d.data.module) return "#dee2e6";
+            const color = packageColor(d);
+            if (!color) return "#dee2e6";
+            return d3.color(color).darker(0.8);
+        }
+
         const tooltip = d3.select("#tooltip");
+        const clustersGroup = g.append("g").attr("class", "clusters");
         const linksGroup = g.append("g").attr("class", "links");
         const dependencyLinksGroup = g.append("g").attr("class", "dependency-links");
-        const incomingLinksGroup = g.append("g").attr("class", "incoming-links");
+        const highlightLinksGroup = g.append("g").attr("class", "highlight-links");
+        const criticalLinksGroup = g.append("g").attr("class", "critical-links");
         const nodesGroup = g.append("g").attr("class", "nodes");
 
         // Create the links
@@ -373,6 +951,20 @@ const htmlTemplate = `
             .attr("fill", "none")
             .attr("stroke", "#ccc");
 
+        // Draw a box around the types of each package in type graphs
+        clustersGroup.selectAll(".package-cluster")
+            .data(root.descendants().filter(d => d.data.cluster && d.children))
+            .enter()
+            .append("rect")
+            .attr("class", "package-cluster")
+            .attr("x", d => d.y - 12)
+            .attr("y", d => d3.min(d.children, c => c.x) - 12)
+            .attr("width", d => d3.max(d.children, c => c.y) - d.y + 140)
+            .attr("height", d => d3.max(d.children, c => c.x) - d3.min(d.children, c => c.x) + 24)
+            .attr("rx", 6)
+            .attr("fill", d => moduleColors.get(d.data.module) || "#dee2e6")
+            .attr("stroke", d => moduleColors.get(d.data.module) || "#dee2e6");
+
         // Create nodes
         const node = nodesGroup.selectAll(".node")
             .data(root.descendants())
@@ -382,6 +974,8 @@ const htmlTemplate = `
                 let classes = ["node"];
                 if (d.data.isPackage) {
                     classes.push("package");
+                    if (d.data.diagnostics.length > 0) classes.push("has-diagnostics");
+                    if (d.data.kind) classes.push(d.data.kind);
                 } else if (d.data.id === d.data.module) {
                     classes.push("module-root");
                 } else {
@@ -397,28 +991,9 @@ const htmlTemplate = `
             .on("mouseout", handleNodeMouseOut);
 
         node.append("circle")
-            .attr("r", function(d) {
-                if (d.data.id === d.data.module) return 8;
-                if (d.data.isPackage) return 6;
-                return 4;
-            })
-            .attr("fill", function(d) {
-                if (!d.data || !d.data.module) return "#f8f9fa";
-                
-                const color = moduleColors.get(d.data.module);
-                if (!color) return "#f8f9fa";
-                
-                // All nodes get their module's color
-                return color;
-            })
-            .attr("stroke", function(d) {
-                if (!d.data || !d.data.module) return "#dee2e6";
-                
-                const color = moduleColors.get(d.data.module);
-                if (!color) return "#dee2e6";
-                
-                return d3.color(color).darker(0.8);
-            });
+            .attr("r", nodeRadius)
+            .attr("fill", nodeFill)
+            .attr("stroke", nodeStroke);
 
         // Add module indicator for module roots
         node.filter(d => d.data.id === d.data.module)
@@ -429,12 +1004,15 @@ const htmlTemplate = `
             .text("M");
 
         // Add labels
+        function labelOffset(d) {
+            const radius = nodeRadius(d);
+            return d.children || d._children ? -radius - 5 : radius + 5;
+        }
+
         node.append("text")
+            .attr("class", "node-label")
             .attr("dy", "0.35em") // This centers text vertically
-            .attr("x", function(d) {
-                const radius = d.data.id === d.data.module ? 8 : (d.data.isPackage ? 6 : 4);
-                return d.children || d._children ? -radius - 5 : radius + 5;
-            })
+            .attr("x", labelOffset)
             .style("text-anchor", function(d) {
                 return d.children || d._children ? "end" : "start";
             })
@@ -461,27 +1039,72 @@ const htmlTemplate = `
             
             let content = '<div class="tooltip-title">' + d.data.id + '</div>';
             content += '<div class="tooltip-module">Module: ' + d.data.module + '</div>';
+            if (d.data.metrics) {
+                const m = d.data.metrics;
+                content += '<div class="tooltip-configs">' + m.files + ' files, ' + m.lines + ' lines, ' +
+                    m.exported + ' exported, ' + m.testFiles + ' test files, complexity ' + m.complexity.toFixed(1) + '</div>';
+            }
+            if (d.data.coverage) {
+                const c = d.data.coverage;
+                content += '<div class="tooltip-configs">Coverage: ' + c.percent.toFixed(1) + '% (' +
+                    c.covered + '/' + c.statements + ' statements)</div>';
+            }
+            if (d.data.component) {
+                content += '<div class="tooltip-module">Component: ' + d.data.component + '</div>';
+            }
+            if (d.data.owners) {
+                content += '<div class="tooltip-module">Owners: ' + d.data.owners.join(", ") + '</div>';
+            }
+            if (d.data.churn) {
+                const ch = d.data.churn;
+                content += '<div class="tooltip-configs">' + ch.commits + ' commits by ' + ch.authors + ' author' +
+                    (ch.authors === 1 ? '' : 's') + ', last modified ' + ch.lastModified + '</div>';
+            }
+            if (d.data.samples) {
+                content += '<div class="tooltip-configs">' + data.profile.sampleType + ': flat ' + formatShare(d.data.samples.flat) +
+                    ', cum ' + formatShare(d.data.samples.cum) + '</div>';
+            }
+            if (d.data.binarySize) {
+                const size = d.data.binarySize;
+                content += '<div class="tooltip-configs">Binary size: own ' + formatBytes(size.own) + ', cumulative ' +
+                    formatBytes(size.cumulative) + ' (' + (100 * size.cumulative / data.binary.total).toFixed(1) + '% of ' +
+                    data.binary.package + ')</div>';
+            }
+            if (d.data.buildTime) {
+                const bt = d.data.buildTime;
+                content += '<div class="tooltip-configs">Compile time: ' + formatMillis(bt.duration) + ', done after ' +
+                    formatMillis(bt.finish) + ' at the earliest' + (bt.critical ? ' (critical path)' : '') + '</div>';
+            }
+            if (d.data.package) {
+                content += '<div class="tooltip-module">Package: ' + d.data.package + ' (' + d.data.kind + ')</div>';
+            }
+            if (d.data.configs) {
+                content += '<div class="tooltip-module">Configurations: ' + d.data.configs.join(", ") + '</div>';
+            }
+            (d.data.diagnostics || []).forEach(diag => {
+                content += '<div class="tooltip-diagnostic">⚠ ' + diag.kind + ': ' + diag.message + '</div>';
+            });
             
             if (d.data.imports && d.data.imports.length > 0) {
-                content += '<div class="tooltip-section">Imports (' + d.data.imports.length + '):</div>';
+                content += '<div class="tooltip-section">' + outgoingLabel + ' (' + d.data.imports.length + '):</div>';
                 content += '<ul class="tooltip-list">';
                 d.data.imports.forEach(imp => {
-                    content += '<li>' + imp + '</li>';
+                    content += '<li>' + imp + linkDetails(d.data.id, imp) + '</li>';
                 });
                 content += '</ul>';
             } else {
-                content += '<div class="tooltip-section">Imports: 0</div>';
+                content += '<div class="tooltip-section">' + outgoingLabel + ': 0</div>';
             }
             
             if (d.data.importedBy && d.data.importedBy.length > 0) {
-                content += '<div class="tooltip-section">Imported by (' + d.data.importedBy.length + '):</div>';
+                content += '<div class="tooltip-section">' + incomingLabel + ' (' + d.data.importedBy.length + '):</div>';
                 content += '<ul class="tooltip-list">';
                 d.data.importedBy.forEach(imp => {
-                    content += '<li>' + imp + '</li>';
+                    content += '<li>' + imp + linkDetails(imp, d.data.id) + '</li>';
                 });
                 content += '</ul>';
             } else {
-                content += '<div class="tooltip-section">Imported by: 0</div>';
+                content += '<div class="tooltip-section">' + incomingLabel + ': 0</div>';
             }
             
             tooltip.html(content)
@@ -494,31 +1117,107 @@ const htmlTemplate = `
             tooltip.style("display", "none");
         }
 
+        // Selecting nodes highlights their dependencies and dependents up to
+        // highlightDepth levels away, -1 for all of them
+        let highlightDepth = viewerOptions.depth || 1;
+        let importDistances = new Map();
+        let importedByDistances = new Map();
+
+        // reachDistances returns the number of steps from the selected nodes
+        // to each node reachable by following the edges, skipping filtered
+        // out nodes
+        function reachDistances(edges) {
+            const distances = new Map();
+            let frontier = Array.from(selectedNodeIds);
+            frontier.forEach(id => distances.set(id, 0));
+            for (let level = 1; frontier.length > 0 && (highlightDepth < 0 || level <= highlightDepth); level++) {
+                const nextFrontier = [];
+                frontier.forEach(id => {
+                    const d = nodeById.get(id);
+                    (d ? d.data[edges] || [] : []).forEach(neighbor => {
+                        const neighborNode = nodeById.get(neighbor);
+                        if (!distances.has(neighbor) && neighborNode && !isFilteredOut(neighborNode)) {
+                            distances.set(neighbor, level);
+                            nextFrontier.push(neighbor);
+                        }
+                    });
+                });
+                frontier = nextFrontier;
+            }
+            return distances;
+        }
+
+        // Nodes and links fade from the highlight color with their distance
+        function distanceColor(color, distance, distances) {
+            const maxDistance = d3.max(distances.values()) || 1;
+            if (maxDistance <= 1) return color;
+            return d3.interpolateRgb(color, "#d8d8d8")(0.8 * (distance - 1) / (maxDistance - 1));
+        }
+
+        function nodeHighlightStroke(d) {
+            const id = d.data.id;
+            if (selectedNodeIds.has(id)) return null;
+            if (importedByDistances.has(id)) return distanceColor("#1f77b4", importedByDistances.get(id), importedByDistances);
+            if (importDistances.has(id)) return distanceColor("#ff7f0e", importDistances.get(id), importDistances);
+            return null;
+        }
+
         function updateNodeStyles() {
             const nodes = nodesGroup.selectAll(".node");
+            importDistances = selectedNodeIds.size > 0 ? reachDistances("imports") : new Map();
+            importedByDistances = selectedNodeIds.size > 0 ? reachDistances("importedBy") : new Map();
+            updateReachPanel();
             
             if (selectedNodeIds.size === 0) {
                 nodes.classed("selected", false)
                      .classed("imported", false)
                      .classed("importing", false);
+                nodes.select("circle").style("stroke", null);
                 return;
             }
 
-            // Get all imports and importedBy for selected nodes
-            let allImports = new Set();
-            let allImportedBy = new Set();
-            
-            selectedNodeIds.forEach(nodeId => {
-                const selectedNode = root.descendants().find(d => d.data.id === nodeId);
-                if (selectedNode && selectedNode.data) {
-                    (selectedNode.data.imports || []).forEach(id => allImports.add(id));
-                    (selectedNode.data.importedBy || []).forEach(id => allImportedBy.add(id));
-                }
-            });
-
             nodes.classed("selected", d => selectedNodeIds.has(d.data.id))
-                 .classed("importing", d => allImports.has(d.data.id) && !selectedNodeIds.has(d.data.id))
-                 .classed("imported", d => allImportedBy.has(d.data.id) && !selectedNodeIds.has(d.data.id));
+                 .classed("importing", d => importDistances.has(d.data.id) && !selectedNodeIds.has(d.data.id))
+                 .classed("imported", d => importedByDistances.has(d.data.id) && !selectedNodeIds.has(d.data.id));
+            nodes.select("circle").style("stroke", nodeHighlightStroke);
+        }
+
+        // Lists per module how many packages the highlight reaches
+        function updateReachPanel() {
+            const panel = d3.select("#reachPanel");
+            panel.selectAll("*").remove();
+            panel.style("display", selectedNodeIds.size > 0 ? "block" : "none");
+            if (selectedNodeIds.size === 0) return;
+
+            const counts = new Map();
+            function count(distances, key) {
+                distances.forEach((distance, id) => {
+                    const d = nodeById.get(id);
+                    if (distance === 0 || !d || !d.data.isPackage) return;
+                    if (!counts.has(d.data.module)) counts.set(d.data.module, {imports: 0, importedBy: 0});
+                    counts.get(d.data.module)[key]++;
+                });
+            }
+            count(importDistances, "imports");
+            count(importedByDistances, "importedBy");
+
+            const unit = isTypeGraph ? "types" : "packages";
+            panel.append("div")
+                .attr("class", "legend-title")
+                .text("Reached " + unit + (highlightDepth < 0 ? "" : " (depth " + highlightDepth + ")"));
+            const table = panel.append("table").attr("class", "reach-table");
+            table.append("tr").html("<th>Module</th><th>" + outgoingLabel + "</th><th>" + incomingLabel + "</th>");
+            Array.from(counts.keys()).sort().forEach(module => {
+                const c = counts.get(module);
+                const row = table.append("tr");
+                row.append("td").text(module).style("color", moduleColors.get(module) || null);
+                row.append("td").text(c.imports);
+                row.append("td").text(c.importedBy);
+            });
+            const total = table.append("tr").style("font-weight", "bold");
+            total.append("td").text("Total");
+            total.append("td").text(d3.sum(Array.from(counts.values()), c => c.imports));
+            total.append("td").text(d3.sum(Array.from(counts.values()), c => c.importedBy));
         }
 
         function generateLinkPath(source, target) {
@@ -535,134 +1234,942 @@ const htmlTemplate = `
             return node.data.module || '';
         }
 
+        // When coloring by owner, the cross-module filter compares owners
         function isCrossModuleDependency(sourceNode, targetNode) {
+            if (colorBy === "owner") return ownerKey(sourceNode) !== ownerKey(targetNode);
             return getModulePath(sourceNode) !== getModulePath(targetNode);
         }
 
-        function updateDependencyVisibility() {
-            // Remove existing dependency links
-            dependencyLinksGroup.selectAll(".dependency-link").remove();
-            incomingLinksGroup.selectAll(".dependency-link").remove();
-            
-            const allNodes = root.descendants();
-            
-            if (selectedNodeIds.size === 0) {
-                // When no node is selected, show all dependencies in green
-                allNodes.forEach(sourceNode => {
-                    if (sourceNode.data.imports) {
-                        sourceNode.data.imports.forEach(targetId => {
-                            const targetNode = allNodes.find(d => d.data.id === targetId);
-                            if (targetNode) {
-                                // Skip if we're showing only cross-module dependencies and this is within the same module
-                                if (showCrossModuleOnly && !isCrossModuleDependency(sourceNode, targetNode)) {
-                                    return;
-                                }
-                                dependencyLinksGroup.append("path")
-                                    .attr("class", "dependency-link all")
-                                    .attr("d", generateLinkPath(sourceNode, targetNode))
-                                    .style("stroke", "#27ae60")  /* darker green color */
-                                    .style("opacity", showOutgoing ? 0.4 : 0)
-                                    .style("fill", "none")
-                                    .style("stroke-width", "1.5px");
-                            }
-                        });
+        function isFilteredOut(node) {
+            return queryVisibleIds !== null && !queryVisibleIds.has(node.data.id);
+        }
+
+        function isLinkFilteredOut(sourceNode, targetNode) {
+            return isFilteredOut(sourceNode) || isFilteredOut(targetNode);
+        }
+
+        function applyQuery(query) {
+            const errorEl = document.getElementById("queryError");
+            errorEl.textContent = "";
+            if (!query.trim()) {
+                queryVisibleIds = null;
+            } else {
+                let matched;
+                try {
+                    matched = evaluateQuery(parseQuery(query), data);
+                } catch (err) {
+                    errorEl.textContent = err.message;
+                    return;
+                }
+                // Keep the folders leading to matched packages visible
+                queryVisibleIds = new Set([""]);
+                root.descendants().forEach(d => {
+                    if (matched.has(d.data.id)) {
+                        d.ancestors().forEach(a => queryVisibleIds.add(a.data.id));
                     }
                 });
-                return;
+                errorEl.textContent = matched.size + " packages match";
             }
 
-            // Show dependencies for selected nodes
-            selectedNodeIds.forEach(nodeId => {
-                const selectedNode = allNodes.find(d => d.data.id === nodeId);
-                if (!selectedNode || !selectedNode.data) return;
+            selectedNodeIds.forEach(id => {
+                if (queryVisibleIds !== null && !queryVisibleIds.has(id)) selectedNodeIds.delete(id);
+            });
+            nodesGroup.selectAll(".node").classed("filtered-out", d => isFilteredOut(d));
+            linksGroup.selectAll(".link").classed("filtered-out", d => isFilteredOut(d.target));
+            clustersGroup.selectAll(".package-cluster").classed("filtered-out", d => isFilteredOut(d));
+            updateNodeStyles();
+            updateDependencyVisibility();
+            if (showDSM) renderDSM();
+            if (showCoupling) renderCoupling();
+            if (showComponents) renderComponents();
+        }
 
-                // Outgoing dependencies (imports)
-                if (showOutgoing && selectedNode.data.imports) {
-                    selectedNode.data.imports.forEach(targetId => {
-                        const targetNode = allNodes.find(d => d.data.id === targetId);
-                        if (targetNode) {
-                            if (showCrossModuleOnly && !isCrossModuleDependency(selectedNode, targetNode)) {
-                                return;
-                            }
-                            dependencyLinksGroup.append("path")
-                                .attr("class", "dependency-link outgoing")
-                                .attr("d", generateLinkPath(selectedNode, targetNode))
-                                .style("stroke", "#ff7f0e")
-                                .style("opacity", 0.4)
-                                .style("fill", "none")
-                                .style("stroke-width", "1.5px");
-                        }
-                    });
-                }
+        // Imports between consecutive packages of the build's critical path
+        // are drawn on top of the other links while it is highlighted
+        function updateCriticalPath() {
+            criticalLinksGroup.selectAll(".dependency-link").remove();
+            nodesGroup.selectAll(".node").classed("critical", d => showCriticalPath && !!d.data.buildTime && d.data.buildTime.critical);
+            document.getElementById("legendCriticalPath").style.display = showCriticalPath ? "block" : "none";
+            if (!showCriticalPath) return;
+
+            data.links.filter(link => link.critical).forEach(link => {
+                const sourceNode = nodeById.get(link.source);
+                const targetNode = nodeById.get(link.target);
+                if (!sourceNode || !targetNode || isLinkFilteredOut(sourceNode, targetNode)) return;
+                criticalLinksGroup.append("path")
+                    .attr("class", "dependency-link critical")
+                    .attr("d", generateLinkPath(sourceNode, targetNode));
+            });
+        }
 
-                // Incoming dependencies (imported by)
-                if (showIncoming && selectedNode.data.importedBy) {
-                    selectedNode.data.importedBy.forEach(sourceId => {
-                        const sourceNode = allNodes.find(d => d.data.id === sourceId);
-                        if (sourceNode) {
-                            if (showCrossModuleOnly && !isCrossModuleDependency(sourceNode, selectedNode)) {
-                                return;
-                            }
-                            incomingLinksGroup.append("path")
-                                .attr("class", "dependency-link incoming")
-                                .attr("d", generateLinkPath(sourceNode, selectedNode))
-                                .style("stroke", "#1f77b4")
-                                .style("opacity", 0.4)
-                                .style("fill", "none")
-                                .style("stroke-width", "1.5px");
-                        }
-                    });
-                }
+        // Import links between hierarchy nodes, with their paths computed once
+        // since the layout never changes
+        const dependencyEdges = [];
+        data.links.forEach(link => {
+            const sourceNode = nodeById.get(link.source);
+            const targetNode = nodeById.get(link.target);
+            if (!sourceNode || !targetNode) return;
+            dependencyEdges.push({
+                key: link.source + "\n" + link.target,
+                source: sourceNode,
+                target: targetNode,
+                path: generateLinkPath(sourceNode, targetNode),
+                dash: linkDash(link.source, link.target),
+                width: linkWidth(link.source, link.target),
+                style: undefined
             });
+        });
+        const edgesByKey = new Map(dependencyEdges.map(e => [e.key, e]));
+
+        // Above the threshold, the links not highlighted by the selection are
+        // drawn on a canvas covering the window below the SVG: thousands of
+        // SVG paths make clicking and zooming sluggish
+        const canvasEdgeThreshold = 2000;
+        const useCanvas = dependencyEdges.length > canvasEdgeThreshold;
+        let currentTransform = d3.zoomIdentity.translate(40, 0);
+        let canvas = null;
+        if (useCanvas) {
+            canvas = d3.select("body").insert("canvas", "svg")
+                .style("position", "fixed")
+                .style("left", "0px")
+                .style("top", "0px")
+                .style("pointer-events", "none")
+                .node();
+            svg.style("position", "relative");
+            resizeCanvas();
+            window.addEventListener("resize", () => {
+                resizeCanvas();
+                drawCanvasEdges();
+            });
+            window.addEventListener("scroll", () => drawCanvasEdges());
+        }
 
-            // Show dimmed dependencies for non-selected nodes
-            allNodes.forEach(sourceNode => {
-                if (!selectedNodeIds.has(sourceNode.data.id) && sourceNode.data.imports) {
-                    sourceNode.data.imports.forEach(targetId => {
-                        const targetNode = allNodes.find(d => d.data.id === targetId);
-                        if (targetNode) {
-                            dependencyLinksGroup.append("path")
-                                .attr("class", "dependency-link background")
-                                .attr("d", generateLinkPath(sourceNode, targetNode))
-                                .style("stroke", "#ddd")
-                                .style("opacity", 0.1)
-                                .style("fill", "none")
-                                .style("stroke-width", "1.5px");
-                        }
-                    });
-                }
+        function resizeCanvas() {
+            canvas.style.width = window.innerWidth + "px";
+            canvas.style.height = window.innerHeight + "px";
+            canvas.width = window.innerWidth * window.devicePixelRatio;
+            canvas.height = window.innerHeight * window.devicePixelRatio;
+        }
+
+        // Style of a link that is not highlighted, or null if hidden
+        function bulkEdgeStyle(edge) {
+            if (isLinkFilteredOut(edge.source, edge.target)) return null;
+            if (selectedNodeIds.size === 0) {
+                // When no node is selected, show all dependencies in green
+                if (!showOutgoing) return null;
+                if (showCrossModuleOnly && !isCrossModuleDependency(edge.source, edge.target)) return null;
+                return allEdgeStyle;
+            }
+            // Dimmed dependencies of the other nodes
+            if (selectedNodeIds.has(edge.source.data.id)) return null;
+            return backgroundEdgeStyle;
+        }
+        // Opacities as set by the style and the CSS class
+        const allEdgeStyle = {className: "all", color: "#27ae60", opacity: 0.4, strokeOpacity: 0.4};
+        const backgroundEdgeStyle = {className: "background", color: "#ddd", opacity: 0.1, strokeOpacity: 0.1};
+
+        // drawCanvasEdges draws the links with the zoom transform, offset by
+        // the position of the SVG in the window
+        function drawCanvasEdges() {
+            const context = canvas.getContext("2d");
+            const ratio = window.devicePixelRatio;
+            const offset = svg.node().getBoundingClientRect();
+            const t = currentTransform;
+            context.setTransform(1, 0, 0, 1, 0, 0);
+            context.clearRect(0, 0, canvas.width, canvas.height);
+            context.setTransform(ratio * t.k, 0, 0, ratio * t.k, ratio * (offset.left + t.x), ratio * (offset.top + t.y));
+
+            // One canvas path per combination of styles
+            const batches = d3.group(dependencyEdges.filter(e => e.style),
+                e => e.style.className + " " + e.width + " " + (e.dash || ""));
+            batches.forEach(edges => {
+                const first = edges[0];
+                context.strokeStyle = first.style.color;
+                context.globalAlpha = first.style.opacity * first.style.strokeOpacity;
+                context.lineWidth = parseFloat(first.width);
+                context.setLineDash(first.dash ? first.dash.split(",").map(Number) : []);
+                context.beginPath();
+                edges.forEach(e => {
+                    const s = e.source;
+                    const t = e.target;
+                    const midY = (s.y + t.y) / 2;
+                    context.moveTo(s.y, s.x);
+                    context.bezierCurveTo(midY, s.x, midY, t.x, t.y, t.x);
+                });
+                context.stroke();
             });
         }
 
-        // Initialize dependency visibility to show all dependencies
-        updateDependencyVisibility();
-        
-        // Add event listeners for toggle buttons
-        document.getElementById("toggleOutgoing").onclick = function() {
-            this.classList.toggle("active");
-            showOutgoing = !showOutgoing;
-            updateDependencyVisibility();
-        };
+        // Below the threshold, every link has an SVG path that is only
+        // restyled when its style changes
+        const bulkLinks = useCanvas ? null : dependencyLinksGroup.selectAll(".dependency-link")
+            .data(dependencyEdges)
+            .enter()
+            .append("path")
+            .attr("d", e => e.path)
+            .style("stroke-dasharray", e => e.dash)
+            .style("stroke-width", e => e.width)
+            .style("fill", "none");
 
-        document.getElementById("toggleIncoming").onclick = function() {
-            this.classList.toggle("active");
-            showIncoming = !showIncoming;
-            updateDependencyVisibility();
-        };
+        function updateDependencyVisibility() {
+            updateCriticalPath();
 
-        d3.select("#toggleCrossModule")
-            .on("click", function() {
-                const btn = d3.select(this);
-                showCrossModuleOnly = !showCrossModuleOnly;
-                btn.classed("active", showCrossModuleOnly);
-                updateDependencyVisibility();
+            let changed = false;
+            dependencyEdges.forEach(e => {
+                const style = bulkEdgeStyle(e);
+                if ((style && style.className) !== (e.style && e.style.className)) changed = true;
+                e.style = style;
             });
+            if (useCanvas) {
+                if (changed) drawCanvasEdges();
+            } else if (changed) {
+                bulkLinks.each(function(e) {
+                    if (this.__class === (e.style && e.style.className)) return;
+                    this.__class = e.style && e.style.className;
+                    d3.select(this)
+                        .attr("class", e.style ? "dependency-link " + e.style.className : "dependency-link")
+                        .style("display", e.style ? null : "none")
+                        .style("stroke", e.style ? e.style.color : null)
+                        .style("opacity", e.style ? e.style.opacity : null);
+                });
+            }
+
+            // Show the dependencies and dependents reached from the selected
+            // nodes, each link leading one level further away
+            const highlighted = [];
+            function addReached(className, color, distances, outgoing) {
+                distances.forEach((distance, id) => {
+                    const node = nodeById.get(id);
+                    if (!node) return;
+                    (node.data[outgoing ? "imports" : "importedBy"] || []).forEach(otherId => {
+                        if (distances.get(otherId) !== distance + 1) return;
+                        const edge = edgesByKey.get(outgoing ? id + "\n" + otherId : otherId + "\n" + id);
+                        if (!edge) return;
+                        if (showCrossModuleOnly && !isCrossModuleDependency(edge.source, edge.target)) {
+                            return;
+                        }
+                        highlighted.push({edge: edge, className: className, color: distanceColor(color, distance + 1, distances)});
+                    });
+                });
+            }
+            if (selectedNodeIds.size > 0 && showOutgoing) {
+                addReached("outgoing", "#ff7f0e", importDistances, true);
+            }
+            if (selectedNodeIds.size > 0 && showIncoming) {
+                addReached("incoming", "#1f77b4", importedByDistances, false);
+            }
+
+            const highlightLinks = highlightLinksGroup.selectAll(".dependency-link")
+                .data(highlighted, h => h.className + "\n" + h.edge.key);
+            highlightLinks.exit().remove();
+            highlightLinks.enter()
+                .append("path")
+                .attr("d", h => h.edge.path)
+                .style("stroke-dasharray", h => h.edge.dash)
+                .style("stroke-width", h => h.edge.width)
+                .style("fill", "none")
+                .style("opacity", 0.4)
+                .merge(highlightLinks)
+                .attr("class", h => "dependency-link " + h.className)
+                .style("stroke", h => h.color)
+                .order();
+        }
+
+        // Dependency structure matrix of the packages passing the query,
+        // ordered like the "dsm" output format: by module, then so that rows
+        // only import earlier columns. Import cycles form blocks on the
+        // diagonal with cells above it.
+        let showDSM = false;
+
+        function dsmWeight(link) {
+            let weight = link.weight || 0;
+            if (weight > 0) return weight;
+            if (data.callGraph) {
+                weight = link.calls || 0;
+            } else {
+                (link.symbols || []).forEach(sym => weight += sym.count);
+            }
+            return Math.max(weight, 1);
+        }
+
+        // Tarjan's algorithm; components are numbered dependencies first
+        function stronglyConnected(ids, edges) {
+            const component = new Map();
+            const index = new Map();
+            const lowlink = new Map();
+            const onStack = new Set();
+            const stack = [];
+            let count = 0;
+            function visit(id) {
+                index.set(id, index.size);
+                lowlink.set(id, index.get(id));
+                stack.push(id);
+                onStack.add(id);
+                (edges.get(id) || []).forEach(next => {
+                    if (!index.has(next)) {
+                        visit(next);
+                        lowlink.set(id, Math.min(lowlink.get(id), lowlink.get(next)));
+                    } else if (onStack.has(next)) {
+                        lowlink.set(id, Math.min(lowlink.get(id), index.get(next)));
+                    }
+                });
+                if (lowlink.get(id) === index.get(id)) {
+                    let top;
+                    do {
+                        top = stack.pop();
+                        onStack.delete(top);
+                        component.set(top, count);
+                    } while (top !== id);
+                    count++;
+                }
+            }
+            ids.forEach(id => {
+                if (!index.has(id)) visit(id);
+            });
+            return component;
+        }
+
+        function buildDSM() {
+            const moduleOf = new Map();
+            data.nodes.forEach(n => {
+                if (queryVisibleIds === null || queryVisibleIds.has(n.id)) moduleOf.set(n.id, n.module);
+            });
+            const ids = Array.from(moduleOf.keys()).sort();
+            const imports = new Map();
+            const moduleImports = new Map();
+            data.links.forEach(link => {
+                if (!moduleOf.has(link.source) || !moduleOf.has(link.target)) return;
+                if (!imports.has(link.source)) imports.set(link.source, []);
+                imports.get(link.source).push(link.target);
+                const from = moduleOf.get(link.source);
+                const to = moduleOf.get(link.target);
+                if (from !== to) {
+                    if (!moduleImports.has(from)) moduleImports.set(from, []);
+                    moduleImports.get(from).push(to);
+                }
+            });
+            const modules = Array.from(new Set(ids.map(id => moduleOf.get(id))));
+            const packageOrder = stronglyConnected(ids, imports);
+            const moduleOrder = stronglyConnected(modules, moduleImports);
+            const packages = ids.slice().sort((a, b) =>
+                (moduleOrder.get(moduleOf.get(a)) - moduleOrder.get(moduleOf.get(b))) ||
+                d3.ascending(moduleOf.get(a), moduleOf.get(b)) ||
+                (packageOrder.get(a) - packageOrder.get(b)));
+
+            const index = new Map(packages.map((id, i) => [id, i]));
+            const cells = [];
+            data.links.forEach(link => {
+                if (index.has(link.source) && index.has(link.target)) {
+                    cells.push({source: link.source, target: link.target, row: index.get(link.source),
+                        col: index.get(link.target), weight: dsmWeight(link)});
+                }
+            });
+
+            // Runs of consecutive rows in the same module or import cycle
+            function blocks(key) {
+                const result = [];
+                packages.forEach((id, i) => {
+                    const last = result[result.length - 1];
+                    if (last && last.key === key(id)) {
+                        last.size++;
+                    } else {
+                        result.push({key: key(id), start: i, size: 1});
+                    }
+                });
+                return result;
+            }
+            return {
+                packages: packages,
+                cells: cells,
+                modules: blocks(id => moduleOf.get(id)),
+                cycles: blocks(id => packageOrder.get(id)).filter(b => b.size > 1)
+            };
+        }
+
+        function selectFromDSM(ids) {
+            selectedNodeIds = new Set(ids);
+            updateNodeStyles();
+            updateDependencyVisibility();
+        }
+
+        function renderDSM() {
+            const panel = d3.select("#dsmPanel");
+            panel.selectAll("*").remove();
+            const dsm = buildDSM();
+            const n = dsm.packages.length;
+            const cell = 14;
+            const labelWidth = 20 + 6 * (d3.max(dsm.packages, id => id.length) || 0);
+            const top = 30;
+            const maxWeight = d3.max(dsm.cells, c => c.weight) || 1;
+            const unit = isTypeGraph ? "types" : "packages";
+
+            panel.append("div")
+                .style("padding", "10px")
+                .style("font-size", "12px")
+                .text(n + " " + unit + ", " + dsm.cells.length + " dependencies, " + dsm.cycles.length + " cycle" +
+                    (dsm.cycles.length === 1 ? "" : "s") + ". Rows depend on columns; cells above the diagonal are " +
+                    "dependencies against the order and only occur in cycles, outlined in red. Click a row or cell to select it.");
+
+            const matrix = panel.append("svg")
+                .attr("width", labelWidth + n * cell + 20)
+                .attr("height", top + n * cell + 20)
+                .append("g")
+                .attr("transform", "translate(" + labelWidth + "," + top + ")");
+
+            matrix.append("rect")
+                .attr("width", n * cell)
+                .attr("height", n * cell)
+                .attr("fill", "#fafafa")
+                .attr("stroke", "#ddd");
+
+            matrix.selectAll(".dsm-module")
+                .data(dsm.modules)
+                .enter()
+                .append("rect")
+                .attr("class", "dsm-module")
+                .attr("x", b => b.start * cell)
+                .attr("y", b => b.start * cell)
+                .attr("width", b => b.size * cell)
+                .attr("height", b => b.size * cell)
+                .attr("fill", b => moduleColors.get(b.key) || "#dee2e6")
+                .attr("fill-opacity", 0.15)
+                .attr("stroke", b => moduleColors.get(b.key) || "#dee2e6");
+
+            matrix.selectAll(".dsm-diagonal")
+                .data(dsm.packages)
+                .enter()
+                .append("rect")
+                .attr("x", (id, i) => i * cell + 1)
+                .attr("y", (id, i) => i * cell + 1)
+                .attr("width", cell - 2)
+                .attr("height", cell - 2)
+                .attr("fill", "#ccc");
+
+            matrix.selectAll(".dsm-cell")
+                .data(dsm.cells)
+                .enter()
+                .append("rect")
+                .attr("class", "dsm-cell")
+                .attr("x", c => c.col * cell + 1)
+                .attr("y", c => c.row * cell + 1)
+                .attr("width", cell - 2)
+                .attr("height", cell - 2)
+                .attr("fill", c => (c.col > c.row ? d3.interpolateReds : d3.interpolateBlues)(0.35 + 0.65 * Math.sqrt(c.weight / maxWeight)))
+                .on("mouseover", function(event, c) {
+                    const [x, y] = d3.pointer(event, document.body);
+                    tooltip.html('<div class="tooltip-title">' + c.source + ' → ' + c.target + '</div>' +
+                            '<div class="tooltip-configs">Weight ' + c.weight + '</div>' + linkDetails(c.source, c.target))
+                        .style("left", (x + 10) + "px")
+                        .style("top", (y + 10) + "px")
+                        .style("display", "block");
+                })
+                .on("mouseout", handleNodeMouseOut)
+                .on("click", (event, c) => selectFromDSM([c.source, c.target]));
+
+            matrix.selectAll(".dsm-cycle")
+                .data(dsm.cycles)
+                .enter()
+                .append("rect")
+                .attr("x", b => b.start * cell)
+                .attr("y", b => b.start * cell)
+                .attr("width", b => b.size * cell)
+                .attr("height", b => b.size * cell)
+                .attr("fill", "none")
+                .attr("stroke", "#c0392b")
+                .attr("stroke-width", 2);
+
+            matrix.selectAll(".dsm-row")
+                .data(dsm.packages)
+                .enter()
+                .append("text")
+                .attr("class", "dsm-label")
+                .attr("x", -4)
+                .attr("y", (id, i) => i * cell + cell / 2)
+                .attr("dy", "0.35em")
+                .attr("text-anchor", "end")
+                .text((id, i) => id + " " + (i + 1))
+                .on("click", (event, id) => selectFromDSM([id]));
+
+            matrix.selectAll(".dsm-column")
+                .data(dsm.packages)
+                .enter()
+                .append("text")
+                .attr("class", "dsm-label")
+                .attr("transform", (id, i) => "translate(" + (i * cell + cell / 2) + ",-4) rotate(-90)")
+                .attr("dy", "0.35em")
+                .text((id, i) => i + 1)
+                .on("click", (event, id) => selectFromDSM([id]));
+        }
+
+        document.getElementById("toggleDSM").onclick = function() {
+            showDSM = !showDSM;
+            this.classList.toggle("active", showDSM);
+            document.getElementById("dsmPanel").style.display = showDSM ? "block" : "none";
+            if (showDSM) renderDSM();
+        };
+
+        // Module coupling: a chord diagram of the imports between the modules
+        // of the packages passing the query, like the "coupling" subcommand
+        let showCoupling = false;
+
+        function moduleCoupling() {
+            const moduleOf = new Map();
+            data.nodes.forEach(n => {
+                if (queryVisibleIds === null || queryVisibleIds.has(n.id)) moduleOf.set(n.id, n.module);
+            });
+            const modules = Array.from(new Set(moduleOf.values())).sort();
+            const index = new Map(modules.map((m, i) => [m, i]));
+            const matrix = modules.map(() => modules.map(() => 0));
+            const imports = new Map();
+            data.links.forEach(link => {
+                const from = moduleOf.get(link.source);
+                const to = moduleOf.get(link.target);
+                if (from === undefined || to === undefined || from === to) return;
+                matrix[index.get(from)][index.get(to)]++;
+                const key = from + "\n" + to;
+                if (!imports.has(key)) imports.set(key, []);
+                imports.get(key).push(link);
+            });
+            return {modules: modules, matrix: matrix, imports: imports};
+        }
+
+        function showCouplingImports(from, to, imports) {
+            const list = d3.select("#couplingImports");
+            list.selectAll("*").remove();
+            list.append("div")
+                .attr("class", "tooltip-title")
+                .text(from + " → " + to + " (" + imports.length + " import" + (imports.length === 1 ? "" : "s") + ")");
+            list.append("ul")
+                .attr("class", "tooltip-list")
+                .selectAll("li")
+                .data(imports)
+                .enter()
+                .append("li")
+                .style("cursor", "pointer")
+                .html(link => link.source + ' → ' + link.target + linkDetails(link.source, link.target))
+                .on("click", (event, link) => selectFromDSM([link.source, link.target]));
+        }
+
+        function renderCoupling() {
+            const panel = d3.select("#couplingPanel");
+            panel.selectAll("*").remove();
+            const coupling = moduleCoupling();
+            const total = d3.sum(coupling.matrix, row => d3.sum(row));
+            panel.append("div")
+                .style("padding", "10px")
+                .style("font-size", "12px")
+                .text(total + " cross-module imports between " + coupling.modules.length + " modules. " +
+                    "Ribbons run from the importing module to the imported one and get wider with the number of package imports. " +
+                    "Click a ribbon to list them.");
+            panel.append("div").attr("id", "couplingImports");
+            if (total === 0) return;
+
+            const size = Math.max(Math.min(window.innerWidth * 0.55, window.innerHeight - 140), 400);
+            const outerRadius = size / 2 - 120;
+            const innerRadius = outerRadius - 12;
+            const chords = d3.chordDirected().padAngle(0.04).sortSubgroups(d3.descending)(coupling.matrix);
+            const chart = panel.append("svg")
+                .attr("width", size)
+                .attr("height", size)
+                .append("g")
+                .attr("transform", "translate(" + size / 2 + "," + size / 2 + ")");
+            const moduleColor = i => moduleColors.get(coupling.modules[i]) || "#999";
+
+            const group = chart.append("g")
+                .selectAll("g")
+                .data(chords.groups)
+                .enter()
+                .append("g");
+            group.append("path")
+                .attr("fill", d => moduleColor(d.index))
+                .attr("stroke", d => d3.color(moduleColor(d.index)).darker(0.8))
+                .attr("d", d3.arc().innerRadius(innerRadius).outerRadius(outerRadius));
+            group.append("text")
+                .each(d => d.angle = (d.startAngle + d.endAngle) / 2)
+                .attr("dy", "0.35em")
+                .attr("font-size", "10px")
+                .attr("transform", d => "rotate(" + (d.angle * 180 / Math.PI - 90) + ") translate(" + (outerRadius + 6) + ")" +
+                    (d.angle > Math.PI ? " rotate(180)" : ""))
+                .attr("text-anchor", d => d.angle > Math.PI ? "end" : null)
+                .text(d => coupling.modules[d.index]);
+
+            chart.append("g")
+                .selectAll("path")
+                .data(chords)
+                .enter()
+                .append("path")
+                .attr("class", "coupling-ribbon")
+                .attr("fill", d => moduleColor(d.source.index))
+                .attr("stroke", d => d3.color(moduleColor(d.source.index)).darker(0.8))
+                .attr("d", d3.ribbonArrow().radius(innerRadius - 1))
+                .on("click", function(event, d) {
+                    chart.selectAll(".coupling-ribbon").classed("active", false);
+                    d3.select(this).classed("active", true);
+                    const from = coupling.modules[d.source.index];
+                    const to = coupling.modules[d.target.index];
+                    showCouplingImports(from, to, coupling.imports.get(from + "\n" + to));
+                })
+                .append("title")
+                .text(d => coupling.modules[d.source.index] + " → " + coupling.modules[d.target.index] + ": " + d.source.value);
+        }
+
+        document.getElementById("toggleCoupling").onclick = function() {
+            showCoupling = !showCoupling;
+            this.classList.toggle("active", showCoupling);
+            document.getElementById("couplingPanel").style.display = showCoupling ? "block" : "none";
+            if (showCoupling) renderCoupling();
+        };
+
+        // Architectural components from the configuration file: the packages
+        // passing the query collapsed into a node per component, with the
+        // imports between them aggregated. Clicking a component expands it
+        // into its packages, clicking one of those collapses it again.
+        let showComponents = false;
+        const expandedComponents = new Set();
+        const componentPositions = new Map();
+        const componentNames = Array.from(new Set(data.nodes.filter(n => n.component).map(n => n.component)));
+        const componentColors = new Map(componentNames.map((name, i) => [name, d3.schemeTableau10[i % 10]]));
+        let componentSimulation = null;
+
+        function componentGraph() {
+            const nodes = new Map();
+            const keyOf = new Map();
+            data.nodes.forEach(n => {
+                if (queryVisibleIds !== null && !queryVisibleIds.has(n.id)) return;
+                const collapsed = !!n.component && !expandedComponents.has(n.component);
+                const key = collapsed ? "component:" + n.component : n.id;
+                keyOf.set(n.id, key);
+                if (!nodes.has(key)) {
+                    nodes.set(key, {key: key, label: collapsed ? n.component : n.id, component: n.component,
+                        collapsed: collapsed, module: n.module, members: []});
+                }
+                nodes.get(key).members.push(n.id);
+            });
+            const links = new Map();
+            data.links.forEach(link => {
+                const source = keyOf.get(link.source);
+                const target = keyOf.get(link.target);
+                if (source === undefined || target === undefined || source === target) return;
+                const key = source + "\n" + target;
+                if (!links.has(key)) links.set(key, {source: source, target: target, imports: []});
+                links.get(key).imports.push(link);
+            });
+            return {nodes: Array.from(nodes.values()), links: Array.from(links.values())};
+        }
+
+        function componentRadius(d) {
+            return d.collapsed ? 8 + 4 * Math.sqrt(d.members.length) : 6;
+        }
+
+        function renderComponents() {
+            const panel = d3.select("#componentsPanel");
+            panel.selectAll("*").remove();
+            if (componentSimulation) componentSimulation.stop();
+            const graph = componentGraph();
+            panel.append("div")
+                .style("padding", "10px")
+                .style("font-size", "12px")
+                .text(componentNames.length + " components. Links get wider with the number of package imports they stand for. " +
+                    "Click a component to expand it into its packages, and one of those to collapse it again.");
+
+            const panelNode = document.getElementById("componentsPanel");
+            const w = Math.max(panelNode.clientWidth, 600);
+            const h = Math.max(panelNode.clientHeight - 50, 400);
+            const chart = panel.append("svg").attr("width", w).attr("height", h);
+            chart.append("defs").append("marker")
+                .attr("id", "componentArrow")
+                .attr("viewBox", "0 -5 10 10")
+                .attr("refX", 10)
+                .attr("markerWidth", 6)
+                .attr("markerHeight", 6)
+                .attr("orient", "auto")
+                .append("path")
+                .attr("d", "M0,-5L10,0L0,5")
+                .attr("fill", "#999");
+
+            // Expanded packages start where their component was
+            graph.nodes.forEach(d => {
+                const position = componentPositions.get(d.key) || componentPositions.get("component:" + d.component);
+                if (position) {
+                    d.x = position.x + (d.collapsed ? 0 : Math.random() * 20 - 10);
+                    d.y = position.y + (d.collapsed ? 0 : Math.random() * 20 - 10);
+                }
+            });
+
+            const link = chart.append("g")
+                .selectAll("line")
+                .data(graph.links)
+                .enter()
+                .append("line")
+                .attr("class", "component-link")
+                .attr("stroke-width", d => Math.min(1 + 1.5 * Math.log2(d.imports.length), 10))
+                .attr("marker-end", "url(#componentArrow)");
+            link.append("title")
+                .text(d => d.imports.length + " import" + (d.imports.length === 1 ? "" : "s") + ":\n" +
+                    d.imports.map(l => l.source + " → " + l.target).join("\n"));
+
+            const componentNode = chart.append("g")
+                .selectAll("g")
+                .data(graph.nodes)
+                .enter()
+                .append("g")
+                .attr("class", "component-node")
+                .on("click", (event, d) => {
+                    if (!d.component) return;
+                    if (d.collapsed) {
+                        expandedComponents.add(d.component);
+                    } else {
+                        expandedComponents.delete(d.component);
+                    }
+                    renderComponents();
+                });
+            componentNode.append("circle")
+                .attr("r", componentRadius)
+                .attr("fill", d => d.component ? componentColors.get(d.component) : (moduleColors.get(d.module) || "#ccc"))
+                .attr("fill-opacity", d => d.collapsed ? 0.9 : 0.5)
+                .attr("stroke", d => d.collapsed ? "#333" : "#999");
+            componentNode.append("text")
+                .attr("x", d => componentRadius(d) + 4)
+                .attr("dy", "0.35em")
+                .style("font-weight", d => d.collapsed ? "bold" : null)
+                .text(d => d.collapsed ? d.label + " (" + d.members.length + ")" : d.label.split("/").pop());
+            componentNode.append("title")
+                .text(d => d.collapsed ? d.label + ":\n" + d.members.join("\n") :
+                    d.label + (d.component ? " (" + d.component + ")" : ""));
+
+            componentSimulation = d3.forceSimulation(graph.nodes)
+                .force("link", d3.forceLink(graph.links).id(d => d.key).distance(d => d.source.collapsed || d.target.collapsed ? 160 : 80))
+                .force("charge", d3.forceManyBody().strength(-300))
+                .force("center", d3.forceCenter(w / 2, h / 2))
+                .force("collide", d3.forceCollide(d => componentRadius(d) + 10))
+                .on("tick", () => {
+                    link.each(function(d) {
+                        // End the arrows at the border of the target circle
+                        const dx = d.target.x - d.source.x;
+                        const dy = d.target.y - d.source.y;
+                        const length = Math.sqrt(dx * dx + dy * dy) || 1;
+                        const r = componentRadius(d.target) + 2;
+                        d3.select(this)
+                            .attr("x1", d.source.x)
+                            .attr("y1", d.source.y)
+                            .attr("x2", d.target.x - dx * r / length)
+                            .attr("y2", d.target.y - dy * r / length);
+                    });
+                    componentNode.attr("transform", d => "translate(" + d.x + "," + d.y + ")");
+                    graph.nodes.forEach(d => componentPositions.set(d.key, {x: d.x, y: d.y}));
+                });
+        }
+
+        if (componentNames.length > 0) {
+            document.getElementById("toggleComponents").style.display = "inline-block";
+        }
+        document.getElementById("toggleComponents").onclick = function() {
+            showComponents = !showComponents;
+            this.classList.toggle("active", showComponents);
+            document.getElementById("componentsPanel").style.display = showComponents ? "block" : "none";
+            if (showComponents) {
+                renderComponents();
+            } else if (componentSimulation) {
+                componentSimulation.stop();
+            }
+        };
+
+        // Apply the configured initial state of the controls
+        document.getElementById("toggleOutgoing").textContent = outgoingLabel;
+        document.getElementById("toggleIncoming").textContent = incomingLabel;
+        document.getElementById("legendImplements").style.display = isTypeGraph ? "flex" : "none";
+        document.querySelectorAll(".legend-calls").forEach(el => el.style.display = data.callGraph ? "flex" : "none");
+        document.getElementById("toggleOutgoing").classList.toggle("active", showOutgoing);
+        document.getElementById("toggleIncoming").classList.toggle("active", showIncoming);
+        document.getElementById("toggleCrossModule").classList.toggle("active", showCrossModuleOnly);
+        document.getElementById("toggleCriticalPath").classList.toggle("active", showCriticalPath);
+        if (data.build) {
+            document.getElementById("toggleCriticalPath").style.display = "inline-block";
+            document.getElementById("criticalPathTitle").textContent = "Critical path: " + formatMillis(data.build.length) +
+                " of " + formatMillis(data.build.total) + " compile time";
+            data.build.criticalPath.forEach(step => {
+                d3.select("#criticalPathList").append("li").text(step.package + " " + formatMillis(step.duration));
+            });
+        }
+
+        // Initialize dependency visibility to show all dependencies
+        updateDependencyVisibility();
+        
+        // Add event listeners for toggle buttons
+        document.getElementById("toggleOutgoing").onclick = function() {
+            this.classList.toggle("active");
+            showOutgoing = !showOutgoing;
+            updateDependencyVisibility();
+        };
+
+        document.getElementById("toggleIncoming").onclick = function() {
+            this.classList.toggle("active");
+            showIncoming = !showIncoming;
+            updateDependencyVisibility();
+        };
+
+        d3.select("#toggleCrossModule")
+            .on("click", function() {
+                const btn = d3.select(this);
+                showCrossModuleOnly = !showCrossModuleOnly;
+                btn.classed("active", showCrossModuleOnly);
+                updateDependencyVisibility();
+            });
+
+        // The last position of the depth slider stands for unlimited depth
+        const depthSlider = document.getElementById("depthSlider");
+        function updateDepthLabel() {
+            document.getElementById("depthValue").textContent = highlightDepth < 0 ? "unlimited" : highlightDepth;
+        }
+        depthSlider.value = highlightDepth < 0 ? depthSlider.max : Math.min(highlightDepth, depthSlider.max - 1);
+        updateDepthLabel();
+        depthSlider.oninput = function() {
+            highlightDepth = this.value === this.max ? -1 : Number(this.value);
+            updateDepthLabel();
+            updateNodeStyles();
+            updateDependencyVisibility();
+        };
+
+        document.getElementById("toggleCriticalPath").onclick = function() {
+            showCriticalPath = !showCriticalPath;
+            this.classList.toggle("active", showCriticalPath);
+            updateCriticalPath();
+        };
+
+        document.querySelectorAll("#colorBy option").forEach(option => {
+            if (colorByOptions[option.value] === false) option.remove();
+        });
+        ownerColors.forEach((color, owners) => {
+            d3.select("#legendOwners").append("div").attr("class", "legend-item").html(
+                '<div class="legend-circle" style="background: ' + color + '; border-color: ' + color + ';"></div>' +
+                '<span class="legend-text">' + owners + '</span>');
+        });
+
+        function updateColorBy() {
+            node.select("circle").attr("fill", nodeFill).attr("stroke", nodeStroke);
+            document.getElementById("legendCoverage").style.display = colorBy === "coverage" ? "flex" : "none";
+            document.getElementById("legendChurn").style.display = colorBy === "churn" ? "flex" : "none";
+            document.getElementById("legendProfile").style.display = colorBy === "profile" ? "flex" : "none";
+            document.getElementById("legendBinarySize").style.display = colorBy === "binarySize" ? "flex" : "none";
+            document.getElementById("legendBuildTime").style.display = colorBy === "buildTime" ? "flex" : "none";
+            document.getElementById("legendOwners").style.display = colorBy === "owner" ? "block" : "none";
+            document.getElementById("toggleCrossModule").textContent = colorBy === "owner" ? "Cross-team only" : "Cross-module only";
+        }
+
+        document.getElementById("colorBy").value = colorBy;
+        document.getElementById("colorBy").onchange = function() {
+            colorBy = this.value;
+            updateColorBy();
+            updateDependencyVisibility();
+        };
+        updateColorBy();
+
+        document.getElementById("sizeBy").value = sizeBy;
+        document.getElementById("sizeBy").onchange = function() {
+            sizeBy = this.value;
+            node.select("circle").attr("r", nodeRadius);
+            node.select(".node-label").attr("x", labelOffset);
+        };
+
+        document.getElementById("applyQuery").onclick = function() {
+            applyQuery(document.getElementById("queryInput").value);
+        };
+
+        document.getElementById("clearQuery").onclick = function() {
+            document.getElementById("queryInput").value = "";
+            applyQuery("");
+        };
+
+        document.getElementById("queryInput").addEventListener("keydown", function(event) {
+            if (event.key === "Enter") applyQuery(this.value);
+        });
+
+        if (viewerOptions.query) {
+            document.getElementById("queryInput").value = viewerOptions.query;
+            applyQuery(viewerOptions.query);
+        }
+
+        // Export the graph as displayed, with the zoom, filters and
+        // highlights, as a standalone SVG with the computed styles inlined
+        const exportedStyles = ["display", "visibility", "opacity", "fill", "fill-opacity", "stroke",
+            "stroke-width", "stroke-opacity", "stroke-dasharray", "filter", "font-family", "font-size",
+            "font-weight", "text-anchor"];
+
+        function exportSVG() {
+            const source = svg.node();
+            const clone = source.cloneNode(true);
+            clone.setAttribute("xmlns", "http://www.w3.org/2000/svg");
+            const canvasLinksGroup = clone.querySelector(".dependency-links");
+            const sourceElements = source.querySelectorAll("*");
+            const cloneElements = clone.querySelectorAll("*");
+            sourceElements.forEach((element, i) => {
+                const computed = window.getComputedStyle(element);
+                cloneElements[i].removeAttribute("class");
+                cloneElements[i].setAttribute("style", exportedStyles
+                    .map(name => name + ":" + computed.getPropertyValue(name))
+                    .join(";"));
+            });
+
+            // Links drawn on the canvas become paths again
+            if (useCanvas) {
+                dependencyEdges.filter(e => e.style).forEach(e => {
+                    d3.select(canvasLinksGroup).append("path")
+                        .attr("d", e.path)
+                        .attr("fill", "none")
+                        .attr("stroke", e.style.color)
+                        .attr("stroke-width", e.width)
+                        .attr("stroke-dasharray", e.dash)
+                        .attr("opacity", e.style.opacity)
+                        .attr("stroke-opacity", e.style.strokeOpacity);
+                });
+            }
+
+            d3.select(clone).insert("rect", ":first-child")
+                .attr("width", "100%")
+                .attr("height", "100%")
+                .attr("fill", window.getComputedStyle(document.body).backgroundColor);
+            return new XMLSerializer().serializeToString(clone);
+        }
+
+        // The URL is revoked in a later task: some browsers, like Firefox,
+        // cancel the download when it is revoked right after the click
+        function download(blob, filename) {
+            const url = URL.createObjectURL(blob);
+            const a = document.createElement("a");
+            a.href = url;
+            a.download = filename;
+            document.body.appendChild(a);
+            a.click();
+            a.remove();
+            setTimeout(() => URL.revokeObjectURL(url), 1000);
+        }
+
+        document.getElementById("exportSVG").onclick = function() {
+            download(new Blob([exportSVG()], {type: "image/svg+xml"}), "dependency_graph.svg");
+        };
+
+        document.getElementById("exportPNG").onclick = function() {
+            const image = new Image();
+            image.onload = function() {
+                const ratio = window.devicePixelRatio;
+                const png = document.createElement("canvas");
+                png.width = width * ratio;
+                png.height = height * ratio;
+                const context = png.getContext("2d");
+                context.scale(ratio, ratio);
+                context.drawImage(image, 0, 0, width, height);
+                png.toBlob(blob => download(blob, "dependency_graph.png"));
+            };
+            image.src = "data:image/svg+xml;charset=utf-8," + encodeURIComponent(exportSVG());
+        };
 
         // Add zoom behavior
         const zoom = d3.zoom()
             .scaleExtent([0.1, 3])
             .on("zoom", (event) => {
                 g.attr("transform", event.transform);
+                currentTransform = event.transform;
+                if (useCanvas) drawCanvasEdges();
             });
 
         svg.call(zoom);
@@ -701,34 +2208,88 @@ type Graph struct {
 	Links          []Link                  `json:"links"`
 	SavedPositions map[string]NodePosition `json:"savedPositions,omitempty"`
 	Modules        []ModuleInfo            `json:"modules"`
+	Viewer         *ViewerOptions          `json:"viewer,omitempty"`
+	CallGraph      string                  `json:"callGraph,omitempty"` // algorithm of the call counts on links, with -calls
+	Profile        *ProfileInfo            `json:"profile,omitempty"`   // profile of the samples on nodes and links, with -pprof
+	Binary         *BinaryInfo             `json:"binary,omitempty"`    // binary of the sizes on nodes, with -binsize
+	Build          *BuildInfo              `json:"build,omitempty"`     // compile times and critical path, with -buildtime
+
+	// Packages as listed by "go list", by import path
+	packages map[string]Package
 }
 
 type Node struct {
-	ID     string `json:"id"`
-	Module string `json:"module"`
+	ID          string          `json:"id"`
+	Module      string          `json:"module"`
+	Diagnostics []Diagnostic    `json:"diagnostics,omitempty"`
+	Configs     []string        `json:"configs,omitempty"` // build configurations containing the package, in matrix mode
+	Metrics     *PackageMetrics `json:"metrics,omitempty"`
+	Coverage    *Coverage       `json:"coverage,omitempty"`   // statement coverage, with -cover
+	Churn       *Churn          `json:"churn,omitempty"`      // git history, with -churn
+	Owners      []string        `json:"owners,omitempty"`     // from CODEOWNERS
+	Samples     *Samples        `json:"samples,omitempty"`    // profile samples, with -pprof
+	BinarySize  *BinarySize     `json:"binarySize,omitempty"` // share of the binary, with -binsize
+	BuildTime   *BuildTime      `json:"buildTime,omitempty"`  // compile time, with -buildtime
+	Component   string          `json:"component,omitempty"`  // architectural component from the configuration
+	Members     []string        `json:"members,omitempty"`    // packages of the component, in component graphs
+
+	// Set in type graphs, whose nodes are named types
+	Package string `json:"package,omitempty"` // package declaring the type
+	Kind    string `json:"kind,omitempty"`    // struct, interface or type
+}
+
+// Diagnostic is a problem detected while building the graph.
+type Diagnostic struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
 }
 
 type Link struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
+	Source   string      `json:"source"`
+	Target   string      `json:"target"`
+	Configs  []string    `json:"configs,omitempty"`  // build configurations containing the import, in matrix mode
+	Symbols  []SymbolUse `json:"symbols,omitempty"`  // identifiers of the target used by the source, with -symbols
+	Kinds    []string    `json:"kinds,omitempty"`    // embeds, field or implements, in type graphs
+	Calls    int         `json:"calls,omitempty"`    // call sites in the source calling into the target, with -calls
+	Samples  int64       `json:"samples,omitempty"`  // profile samples flowing from the source into the target, with -pprof
+	Critical bool        `json:"critical,omitempty"` // on the critical path of the build, with -buildtime
+	Weight   int         `json:"weight,omitempty"`   // package imports aggregated into the link, in component graphs
 }
 
 type Package struct {
-	ImportPath string
-	Imports    []string
+	ImportPath   string
+	Name         string
+	Dir          string
+	GoFiles      []string
+	CgoFiles     []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+}
+
+// moduleForImportPath returns the module owning importPath: the module with
+// the longest path that equals importPath or one of its leading path
+// segments, so that example.com/foo does not claim example.com/foobar and
+// nested modules win over their parents.
+func moduleForImportPath(importPath string, modules []ModuleInfo) (ModuleInfo, bool) {
+	var best ModuleInfo
+	found := false
+	for _, mod := range modules {
+		if importPath != mod.ModulePath && !strings.HasPrefix(importPath, mod.ModulePath+"/") {
+			continue
+		}
+		if !found || len(mod.ModulePath) > len(best.ModulePath) {
+			best = mod
+			found = true
+		}
+	}
+	return best, found
 }
 
 func findModules(rootDir string) ([]ModuleInfo, error) {
 	var modules []ModuleInfo
-	colors := []string{
-		"#3498db", // Blue
-		"#9b59b6", // Purple
-		"#f1c40f", // Yellow
-		"#e67e22", // Orange
-		"#1abc9c", // Turquoise
-		"#34495e", // Dark Blue
-	}
-	colorIndex := 0
 
 	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -736,8 +2297,11 @@ func findModules(rootDir string) ([]ModuleInfo, error) {
 		}
 
 		// Check if path should be ignored
-		if shouldIgnorePath(path, rootDir) {
-			return filepath.SkipDir
+		if shouldIgnorePath(path, rootDir, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
 		if info.Name() == "go.mod" {
@@ -766,14 +2330,14 @@ func findModules(rootDir string) ([]ModuleInfo, error) {
 				moduleName = filepath.Base(relPath) // fallback to directory name
 			}
 
-			color := colors[colorIndex%len(colors)]
-			colorIndex++
+			if shouldExcludePackage(moduleName) {
+				return nil
+			}
 
 			modules = append(modules, ModuleInfo{
 				Path:       relPath,
 				Dir:        filepath.Dir(path),
 				Name:       filepath.Base(relPath),
-				Color:      color,
 				ModulePath: moduleName,
 			})
 		}
@@ -799,12 +2363,14 @@ func loadSavedPositions() (map[string]NodePosition, error) {
 	return positions, nil
 }
 
-func extractPackageDependencies() (*Graph, error) {
+// extractPackageDependencies builds the graph of the modules below the
+// current directory.
+func extractPackageDependencies(opts loadOptions) (*Graph, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current directory: %v", err)
 	}
-	fmt.Printf("Current directory: %s\n", currentDir)
+	fmt.Fprintf(os.Stderr, "Current directory: %s\n", currentDir)
 
 	// Find all modules
 	modules, err := findModules(currentDir)
@@ -812,174 +2378,762 @@ func extractPackageDependencies() (*Graph, error) {
 		return nil, fmt.Errorf("failed to find modules: %v", err)
 	}
 
-	var allPackages []Package
-	for _, module := range modules {
-		fmt.Printf("\nProcessing module in directory: %s\n", module.Dir)
+	// Annotate nodes and links with their build configurations only when
+	// several of them are merged
+	annotate := len(opts.configs) > 1
 
-		// Change to module directory
-		if err := os.Chdir(module.Dir); err != nil {
-			fmt.Printf("Warning: failed to change to directory %s: %v\n", module.Dir, err)
-			continue
+	// Create graph
+	graph := &Graph{
+		Modules:  modules,
+		packages: make(map[string]Package),
+	}
+
+	// Helper function to check if a package belongs to our modules
+	isInternalPackage := func(pkgPath string) bool {
+		_, ok := moduleForImportPath(pkgPath, modules)
+		return ok
+	}
+
+	nodeIndex := make(map[string]int)
+	linkIndex := make(map[linkKey]int)
+	for c, modulePackages := range loadPackages(modules, opts) {
+		configName := ""
+		if annotate {
+			configName = opts.configs[c].String()
 		}
 
-		cmd := exec.Command("go", "list", "-json", "./...")
-		output, err := cmd.Output()
-		if err != nil {
-			fmt.Printf("Warning: failed to list packages in %s: %v\n", module.Dir, err)
-			continue
+		// Remember which module listed each package: its directory belongs
+		// to that module, whatever its import path says
+		var allPackages []Package
+		var listedBy []ModuleInfo
+		for i, packages := range modulePackages {
+			for _, pkg := range packages {
+				if shouldIgnorePath(pkg.Dir, currentDir, true) || shouldExcludePackage(pkg.ImportPath) {
+					continue
+				}
+				allPackages = append(allPackages, pkg)
+				listedBy = append(listedBy, modules[i])
+			}
 		}
 
-		decoder := json.NewDecoder(bytes.NewReader(output))
-		for decoder.More() {
-			var pkg Package
-			if err := decoder.Decode(&pkg); err != nil {
-				fmt.Printf("Warning: failed to decode package: %v\n", err)
+		// Create nodes
+		seen := make(map[string]bool)
+		for i, pkg := range allPackages {
+			// Only create nodes for packages in our modules
+			if !isInternalPackage(pkg.ImportPath) || seen[pkg.ImportPath] {
 				continue
 			}
-			allPackages = append(allPackages, pkg)
+			seen[pkg.ImportPath] = true
+
+			if idx, ok := nodeIndex[pkg.ImportPath]; ok {
+				if annotate {
+					graph.Nodes[idx].Configs = append(graph.Nodes[idx].Configs, configName)
+				}
+				continue
+			}
+
+			node := Node{
+				ID:     pkg.ImportPath,
+				Module: listedBy[i].ModulePath,
+			}
+			if annotate {
+				node.Configs = []string{configName}
+			}
+
+			// Report packages whose import path points into another module,
+			// e.g. a directory shadowed by a nested module's path
+			if mod, _ := moduleForImportPath(pkg.ImportPath, modules); mod.ModulePath != node.Module {
+				diagnostic := Diagnostic{
+					Kind: "module",
+					Message: fmt.Sprintf("directory %s belongs to module %s, but import path resolves to module %s (%s)",
+						pkg.Dir, node.Module, mod.ModulePath, mod.Dir),
+				}
+				fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", pkg.ImportPath, diagnostic.Message)
+				node.Diagnostics = append(node.Diagnostics, diagnostic)
+			}
+
+			nodeIndex[node.ID] = len(graph.Nodes)
+			graph.Nodes = append(graph.Nodes, node)
+			graph.packages[node.ID] = pkg
 		}
 
-		// Change back to root directory
-		if err := os.Chdir(currentDir); err != nil {
-			return nil, fmt.Errorf("failed to change back to root directory: %v", err)
+		// Create links only between internal packages
+		for _, pkg := range allPackages {
+			if !isInternalPackage(pkg.ImportPath) {
+				continue
+			}
+
+			for _, imp := range pkg.Imports {
+				// Only include dependencies between our internal packages
+				if !seen[imp] {
+					continue
+				}
+				key := linkKey{source: pkg.ImportPath, target: imp}
+				idx, ok := linkIndex[key]
+				if !ok {
+					idx = len(graph.Links)
+					linkIndex[key] = idx
+					graph.Links = append(graph.Links, Link{Source: pkg.ImportPath, Target: imp})
+				}
+				if annotate && !containsString(graph.Links[idx].Configs, configName) {
+					graph.Links[idx].Configs = append(graph.Links[idx].Configs, configName)
+				}
+			}
 		}
 	}
 
-	// Create graph
-	graph := &Graph{
-		Modules: modules,
+	return graph, nil
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
 	}
+	return false
+}
 
-	// First pass: Create all nodes and build module prefix map
-	moduleMap := make(map[string]bool)
-	for _, mod := range modules {
-		moduleMap[mod.ModulePath] = true
+// setIgnoredPaths compiles the ignore and exclude patterns.
+func setIgnoredPaths(ignore, exclude []string) {
+	var err error
+	ignoredPaths, err = newPathMatcher(ignore, true)
+	if err != nil {
+		log.Fatalf("Invalid ignore pattern: %v", err)
+	}
+	excludedImportPaths, err = newPathMatcher(exclude, false)
+	if err != nil {
+		log.Fatalf("Invalid exclude pattern: %v", err)
 	}
+}
 
-	// Helper function to check if a package belongs to our modules
-	isInternalPackage := func(pkgPath string) bool {
-		for modPath := range moduleMap {
-			if strings.HasPrefix(pkgPath, modPath) {
-				return true
-			}
+// splitList splits a comma-separated flag value and trims spaces from the items.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// enterWorkDir resolves workDir to an absolute path and changes into it.
+func enterWorkDir(workDir string) string {
+	// Convert to absolute path
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		log.Fatalf("Failed to get absolute path: %v", err)
+	}
+
+	// Verify directory exists
+	if stat, err := os.Stat(absWorkDir); err != nil || !stat.IsDir() {
+		log.Fatalf("Invalid working directory: %s", absWorkDir)
+	}
+
+	// Change to the working directory
+	if err := os.Chdir(absWorkDir); err != nil {
+		log.Fatalf("Failed to change to working directory: %v", err)
+	}
+	return absWorkDir
+}
+
+// commonFlags holds the flags shared by the main command and its subcommands.
+type commonFlags struct {
+	fs        *flag.FlagSet
+	config    string
+	ignore    string
+	exclude   string
+	outputs   outputList
+	format    string
+	jobs      int
+	noCache   bool
+	palette   string
+	goos      string
+	goarch    string
+	tags      string
+	matrix    buildConfigList
+	symbols   bool
+	calls     string
+	cover     string
+	churn     string
+	owners    string
+	pprof     string
+	binsize   string
+	buildtime bool
+}
+
+func registerCommonFlags(fs *flag.FlagSet) *commonFlags {
+	f := &commonFlags{fs: fs}
+	fs.IntVar(&f.jobs, "j", runtime.NumCPU(), "Number of modules to load concurrently")
+	fs.BoolVar(&f.noCache, "no-cache", false, "Do not use the package cache")
+	fs.StringVar(&f.goos, "goos", "", "GOOS to load packages for (default: host)")
+	fs.StringVar(&f.goarch, "goarch", "", "GOARCH to load packages for (default: host)")
+	fs.StringVar(&f.tags, "tags", "", "Comma-separated list of build tags")
+	fs.Var(&f.matrix, "matrix", "Build configuration as goos/goarch:tags, may be repeated to merge several configurations")
+	fs.BoolVar(&f.symbols, "symbols", false, "Type-check packages to record which identifiers each import uses")
+	fs.StringVar(&f.calls, "calls", "", "Build a static call graph and record call sites per import: "+strings.Join(callGraphAlgorithms, " or "))
+	fs.StringVar(&f.cover, "cover", "", "Comma-separated list of cover profiles (go test -coverprofile) to annotate packages with")
+	fs.StringVar(&f.churn, "churn", "", "Window of git history to compute churn over, e.g. 90.days or 2024-01-01 (anything git log --since accepts)")
+	fs.StringVar(&f.owners, "codeowners", "", "CODEOWNERS file (default: CODEOWNERS, .github/CODEOWNERS, docs/CODEOWNERS or .gitlab/CODEOWNERS in the repository, if present)")
+	fs.StringVar(&f.pprof, "pprof", "", "pprof profile (e.g. cpu.pprof or profile.pb.gz) whose samples to attribute to packages")
+	fs.StringVar(&f.binsize, "binsize", "", "Import path of a main package to build and attribute the binary size of to packages")
+	fs.BoolVar(&f.buildtime, "buildtime", false, "Rebuild all modules from scratch to time package compilation and find the critical path of the build")
+	fs.StringVar(&f.palette, "palette", "", "Module color palette: "+strings.Join(paletteNames(), ", ")+" (default "+defaultPalette+")")
+	fs.StringVar(&f.config, "config", "", "Configuration file (default: "+defaultConfigFile+" in the root directory, if present)")
+	fs.StringVar(&f.ignore, "ignore", "", "Comma-separated list of gitignore-style patterns of paths to ignore (relative to root directory)")
+	fs.StringVar(&f.exclude, "exclude", "", "Comma-separated list of gitignore-style patterns of import paths to exclude")
+	return f
+}
+
+// registerOutputFlags adds the flags of the commands that write graphs.
+func (f *commonFlags) registerOutputFlags(defaultFormat string) {
+	f.fs.Var(&f.outputs, "o", "Output file as [format:]path, may be repeated; \"-\" writes to stdout")
+	f.fs.StringVar(&f.format, "format", defaultFormat, "Output format for stdout and unknown file extensions: "+strings.Join(outputFormats, ", "))
+}
+
+// isSet reports whether the named flag was given on the command line.
+func (f *commonFlags) isSet(name string) bool {
+	set := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// setup changes into workDir, loads the configuration file and applies the
+// ignore patterns. Flags given on the command line override the file.
+func (f *commonFlags) setup(workDir string) (string, *Config) {
+	configPath := f.config
+	if configPath != "" {
+		var err error
+		if configPath, err = filepath.Abs(configPath); err != nil {
+			log.Fatalf("Failed to get absolute path: %v", err)
 		}
-		return false
 	}
 
-	// Create nodes
-	nodeMap := make(map[string]bool)
-	for _, pkg := range allPackages {
-		// Only create nodes for packages in our modules
-		if isInternalPackage(pkg.ImportPath) {
-			if !nodeMap[pkg.ImportPath] {
-				nodeMap[pkg.ImportPath] = true
-
-				// Find which module this package belongs to
-				var moduleName string
-				for _, mod := range modules {
-					if strings.HasPrefix(pkg.ImportPath, mod.ModulePath) {
-						moduleName = mod.ModulePath
-						break
-					}
-				}
+	// Paths given on the command line are relative to the current directory
+	for i, output := range f.outputs {
+		if output.Path != stdoutPath {
+			absPath, err := filepath.Abs(output.Path)
+			if err != nil {
+				log.Fatalf("Failed to get absolute path: %v", err)
+			}
+			f.outputs[i].Path = absPath
+		}
+	}
 
-				graph.Nodes = append(graph.Nodes, Node{
-					ID:     pkg.ImportPath,
-					Module: moduleName,
-				})
+	coverProfiles := splitList(f.cover)
+	for i, profile := range coverProfiles {
+		absPath, err := filepath.Abs(profile)
+		if err != nil {
+			log.Fatalf("Failed to get absolute path: %v", err)
+		}
+		coverProfiles[i] = absPath
+	}
+	f.cover = strings.Join(coverProfiles, ",")
+	for _, file := range []*string{&f.owners, &f.pprof} {
+		if *file != "" {
+			absPath, err := filepath.Abs(*file)
+			if err != nil {
+				log.Fatalf("Failed to get absolute path: %v", err)
 			}
+			*file = absPath
 		}
 	}
 
-	// Second pass: Create links only between internal packages
-	for _, pkg := range allPackages {
-		if !isInternalPackage(pkg.ImportPath) {
-			continue
+	absWorkDir := enterWorkDir(workDir)
+	if configPath == "" {
+		configPath = filepath.Join(absWorkDir, defaultConfigFile)
+	}
+	cfg, err := loadConfig(configPath, f.config != "")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if f.isSet("ignore") {
+		cfg.Ignore = splitList(f.ignore)
+	}
+	if f.isSet("exclude") {
+		cfg.Exclude = splitList(f.exclude)
+	}
+	if len(f.outputs) > 0 {
+		cfg.Outputs = f.outputs
+	}
+	if len(f.matrix) > 0 {
+		cfg.Matrix = nil
+		for _, build := range f.matrix {
+			cfg.Matrix = append(cfg.Matrix, build.String())
+		}
+	}
+	if len(cfg.Matrix) > 0 && (f.goos != "" || f.goarch != "" || f.tags != "") {
+		log.Fatal("-goos, -goarch and -tags cannot be combined with a build matrix")
+	}
+	if f.isSet("palette") {
+		if _, err := paletteColors(f.palette, 0); err != nil {
+			log.Fatal(err)
 		}
+		cfg.Palette = f.palette
+	}
+	if f.calls != "" && !containsString(callGraphAlgorithms, f.calls) {
+		log.Fatalf("Unknown call graph algorithm %q (supported: %s)", f.calls, strings.Join(callGraphAlgorithms, ", "))
+	}
+	if f.format != "" && !isOutputFormat(f.format) {
+		log.Fatalf("Unknown output format %q (supported: %s)", f.format, strings.Join(outputFormats, ", "))
+	}
+	setIgnoredPaths(cfg.Ignore, cfg.Exclude)
+	return absWorkDir, cfg
+}
 
-		for _, imp := range pkg.Imports {
-			// Only include dependencies between our internal packages
-			if isInternalPackage(imp) {
-				graph.Links = append(graph.Links, Link{
-					Source: pkg.ImportPath,
-					Target: imp,
-				})
-			}
+// buildConfigs returns the build configurations to load: the matrix, or
+// the single configuration given by -goos, -goarch and -tags.
+func (f *commonFlags) buildConfigs(cfg *Config) []buildConfig {
+	var configs []buildConfig
+	for _, value := range cfg.Matrix {
+		build, err := parseBuildConfig(value)
+		if err != nil {
+			log.Fatal(err)
 		}
+		configs = append(configs, build)
+	}
+	if len(configs) == 0 {
+		configs = []buildConfig{{GOOS: f.goos, GOARCH: f.goarch, Tags: splitList(f.tags)}}
 	}
+	return configs
+}
 
-	return graph, nil
+// buildGraph extracts the dependency graph and applies the configuration to it.
+func (f *commonFlags) buildGraph(cfg *Config) *Graph {
+	opts := loadOptions{jobs: f.jobs, noCache: f.noCache, configs: f.buildConfigs(cfg)}
+
+	graph, err := extractPackageDependencies(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rootDir, _ := os.Getwd()
+	attachMetrics(graph)
+	if err := assignComponents(graph, cfg.Components); err != nil {
+		log.Fatal(err)
+	}
+	if f.cover != "" {
+		coverage, err := loadCoverProfiles(splitList(f.cover))
+		if err != nil {
+			log.Fatal(err)
+		}
+		attachCoverage(graph, coverage)
+	}
+	if f.churn != "" {
+		if err := attachChurn(graph, rootDir, f.churn); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if f.pprof != "" {
+		if err := attachProfile(graph, f.pprof); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if f.binsize != "" {
+		// The binary is built for the first build configuration
+		if err := attachBinarySize(graph, f.binsize, opts.configs[0]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if f.buildtime {
+		// The build is timed for the first build configuration
+		if err := attachBuildTimes(graph, opts.configs[0]); err != nil {
+			log.Fatal(err)
+		}
+		writeCriticalPath(os.Stderr, graph.Build)
+	}
+	codeowners, repoRoot := findCodeowners(rootDir)
+	if f.owners != "" {
+		codeowners = f.owners
+	}
+	if codeowners != "" {
+		rules, err := parseCodeowners(codeowners)
+		if err != nil {
+			log.Fatalf("Failed to read CODEOWNERS: %v", err)
+		}
+		attachOwners(graph, rules, repoRoot)
+	}
+
+	if f.symbols {
+		// Symbols are collected for the first build configuration only
+		pkgs, err := loadTypedPackages(graph.Modules, opts.configs[0], rootDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		attachSymbolUses(graph, pkgs)
+	}
+	if f.calls != "" {
+		// Like symbols, calls are collected for the first build configuration only
+		groups, err := loadTypedModules(graph.Modules, opts.configs[0], rootDir, callGraphLoadMode(f.calls))
+		if err != nil {
+			log.Fatal(err)
+		}
+		attachCallCounts(graph, groups, f.calls)
+	}
+	if err := assignModuleColors(graph.Modules, cfg.Palette, cfg.Colors); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Viewer != (ViewerOptions{}) {
+		graph.Viewer = &cfg.Viewer
+	}
+	return graph
 }
 
-func main() {
-	var ignoredPathsFlag string
-	flag.StringVar(&ignoredPathsFlag, "ignore", "", "Comma-separated list of paths to ignore (relative to root directory)")
+// runQuery implements the "query" subcommand, which evaluates a query
+// expression and writes the resulting subgraph to stdout unless -o is given.
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	common := registerCommonFlags(fs)
+	common.registerOutputFlags("json")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s query [options] <expression> [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nEvaluates a query expression and writes the matching subgraph to stdout or the -o outputs.\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  deps(example.com/api/...) - deps(example.com/legacy/...)\n")
+		fmt.Fprintf(os.Stderr, "  rdeps(example.com/api/auth, 2)\n")
+		fmt.Fprintf(os.Stderr, "  module(foo) & imports(example.com/bar)\n")
+		fmt.Fprintf(os.Stderr, "\nFunctions: deps(x[, depth]), rdeps(x[, depth]), imports(x), module(pattern), allpaths(from, to)\n")
+		fmt.Fprintf(os.Stderr, "Operators: + or | (union), - (difference), & (intersection)\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] [working_directory]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "\nGenerates a dependency graph visualization for a Go project.\n")
-		fmt.Fprintf(os.Stderr, "\nArguments:\n")
-		fmt.Fprintf(os.Stderr, "  working_directory    The root directory of the Go project (default: current directory)\n")
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Validate the query before loading packages
+	if _, err := parseQuery(fs.Arg(0)); err != nil {
+		log.Fatalf("Invalid query: %v", err)
+	}
+
+	workDir := "."
+	if fs.NArg() > 1 {
+		workDir = fs.Arg(1)
+	}
+	absWorkDir, cfg := common.setup(workDir)
+	graph := common.buildGraph(cfg)
+
+	result, err := evaluateQuery(graph, fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Configured outputs are for the whole graph, so only -o applies here
+	outputs := []OutputConfig(common.outputs)
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Path: stdoutPath}}
+	}
+	if err := writeOutputs(absWorkDir, outputs, common.format, result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runUnused implements the "unused" subcommand, which reports cleanup
+// candidates: unused internal packages and exported identifiers.
+func runUnused(args []string) {
+	fs := flag.NewFlagSet("unused", flag.ExitOnError)
+	common := registerCommonFlags(fs)
+	jsonOutput := fs.Bool("json", false, "Write the report as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s unused [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nLists per module the internal packages that no other internal package imports\n")
+		fmt.Fprintf(os.Stderr, "(except main and test-only packages) and the exported identifiers that no\n")
+		fmt.Fprintf(os.Stderr, "other internal package references.\n")
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
-		flag.PrintDefaults()
+		fs.PrintDefaults()
 	}
-	flag.Parse()
+	fs.Parse(args)
+
+	workDir := "."
+	if fs.NArg() > 0 {
+		workDir = fs.Arg(0)
+	}
+	absWorkDir, cfg := common.setup(workDir)
+	graph := common.buildGraph(cfg)
+
+	pkgs, err := loadTypedPackages(graph.Modules, common.buildConfigs(cfg)[0], absWorkDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report := buildUnusedReport(graph, pkgs)
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = writeUnusedReport(os.Stdout, report)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runTypes implements the "types" subcommand, which writes the graph of the
+// named types of the selected packages.
+func runTypes(args []string) {
+	fs := flag.NewFlagSet("types", flag.ExitOnError)
+	common := registerCommonFlags(fs)
+	common.registerOutputFlags("html")
+	selection := fs.String("packages", "", "Query expression selecting the packages whose types are shown (default: all)")
+	exportedOnly := fs.Bool("exported", false, "Show exported types only")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s types [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nGenerates the graph of the named types of the selected packages, linked by struct\n")
+		fmt.Fprintf(os.Stderr, "embedding, field types and interface implementations (default output: type_graph.html).\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
 
-	// Parse ignored paths
-	if ignoredPathsFlag != "" {
-		ignoredPaths = strings.Split(ignoredPathsFlag, ",")
-		// Trim spaces from paths
-		for i := range ignoredPaths {
-			ignoredPaths[i] = strings.TrimSpace(ignoredPaths[i])
+	if *selection != "" {
+		if _, err := parseQuery(*selection); err != nil {
+			log.Fatalf("Invalid query: %v", err)
 		}
 	}
 
 	workDir := "."
-	if flag.NArg() > 0 {
-		workDir = flag.Arg(0)
+	if fs.NArg() > 0 {
+		workDir = fs.Arg(0)
+	}
+	absWorkDir, cfg := common.setup(workDir)
+	graph := common.buildGraph(cfg)
+
+	selected := make(nodeSet)
+	if *selection != "" {
+		var err error
+		if selected, err = evalQuery(newGraphIndex(graph), *selection); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, node := range graph.Nodes {
+			selected[node.ID] = true
+		}
 	}
 
-	// Convert to absolute path
-	absWorkDir, err := filepath.Abs(workDir)
+	pkgs, err := loadTypedPackages(graph.Modules, common.buildConfigs(cfg)[0], absWorkDir)
 	if err != nil {
-		log.Fatalf("Failed to get absolute path: %v", err)
+		log.Fatal(err)
 	}
+	typeGraph := buildTypeGraph(graph, pkgs, selected, *exportedOnly)
 
-	// Verify directory exists
-	if stat, err := os.Stat(absWorkDir); err != nil || !stat.IsDir() {
-		log.Fatalf("Invalid working directory: %s", absWorkDir)
+	// Configured outputs are for the package graph, so only -o applies here
+	outputs := []OutputConfig(common.outputs)
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Path: "type_graph.html"}}
 	}
+	if err := writeOutputs(absWorkDir, outputs, common.format, typeGraph); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	// Change to the working directory
-	if err := os.Chdir(absWorkDir); err != nil {
-		log.Fatalf("Failed to change to working directory: %v", err)
+// runHotspots implements the "hotspots" subcommand, which ranks packages
+// by their number of dependents and lack of test coverage.
+func runHotspots(args []string) {
+	fs := flag.NewFlagSet("hotspots", flag.ExitOnError)
+	common := registerCommonFlags(fs)
+	jsonOutput := fs.Bool("json", false, "Write the report as JSON")
+	top := fs.Int("top", 20, "Number of packages to list, 0 for all")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s hotspots -cover <profiles> [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nRanks packages by risk: the number of packages depending on them, directly or\n")
+		fmt.Fprintf(os.Stderr, "indirectly, times the fraction of their statements not covered by tests.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
 	}
+	fs.Parse(args)
 
-	data, err := extractPackageDependencies()
+	if common.cover == "" {
+		fmt.Fprintf(os.Stderr, "hotspots needs cover profiles, see -cover\n")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	workDir := "."
+	if fs.NArg() > 0 {
+		workDir = fs.Arg(0)
+	}
+	_, cfg := common.setup(workDir)
+	graph := common.buildGraph(cfg)
+
+	hotspots := rankHotspots(graph)
+	if *top > 0 && len(hotspots) > *top {
+		hotspots = hotspots[:*top]
+	}
+
+	var err error
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(hotspots)
+	} else {
+		err = writeHotspots(os.Stdout, hotspots)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	jsonData, err := json.Marshal(data)
+// runCoupling implements the "coupling" subcommand, which counts the
+// package imports between each pair of modules.
+func runCoupling(args []string) {
+	fs := flag.NewFlagSet("coupling", flag.ExitOnError)
+	common := registerCommonFlags(fs)
+	jsonOutput := fs.Bool("json", false, "Write the report as JSON")
+	listImports := fs.Bool("imports", false, "List the package imports behind each pair of modules")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s coupling [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nCounts the package imports between each pair of modules.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	workDir := "."
+	if fs.NArg() > 0 {
+		workDir = fs.Arg(0)
+	}
+	_, cfg := common.setup(workDir)
+	graph := common.buildGraph(cfg)
+
+	couplings := moduleCoupling(graph)
+	var err error
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(couplings)
+	} else {
+		err = writeCoupling(os.Stdout, couplings, *listImports)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// Create template
-	tmpl := template.Must(template.New("graph").Parse(htmlTemplate))
+// runComponents implements the "components" subcommand, which collapses
+// the packages of each configured component into a single node.
+func runComponents(args []string) {
+	fs := flag.NewFlagSet("components", flag.ExitOnError)
+	common := registerCommonFlags(fs)
+	common.registerOutputFlags("json")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s components [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nCollapses the packages of each component defined in the configuration file\n")
+		fmt.Fprintf(os.Stderr, "into a single node and prints the components and the imports between them,\n")
+		fmt.Fprintf(os.Stderr, "or writes the collapsed graph to the -o outputs.\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
 
-	// Create output file in the working directory
-	outputPath := filepath.Join(absWorkDir, "dependency_graph.html")
-	f, err := os.Create(outputPath)
-	if err != nil {
-		log.Fatalf("Failed to create output file: %v", err)
+	workDir := "."
+	if fs.NArg() > 0 {
+		workDir = fs.Arg(0)
 	}
-	defer f.Close()
+	absWorkDir, cfg := common.setup(workDir)
+	if len(cfg.Components) == 0 {
+		log.Fatal("No components defined in the configuration file")
+	}
+	collapsed := componentGraph(common.buildGraph(cfg))
 
-	// Execute template and write to file
-	if err := tmpl.Execute(f, string(jsonData)); err != nil {
+	// Only outputs given on the command line, the configured ones are for
+	// the package graph
+	if len(common.outputs) > 0 {
+		if err := writeOutputs(absWorkDir, common.outputs, common.format, collapsed); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := writeComponents(os.Stdout, collapsed); err != nil {
 		log.Fatal(err)
 	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "query":
+			runQuery(os.Args[2:])
+			return
+		case "unused":
+			runUnused(os.Args[2:])
+			return
+		case "types":
+			runTypes(os.Args[2:])
+			return
+		case "hotspots":
+			runHotspots(os.Args[2:])
+			return
+		case "coupling":
+			runCoupling(os.Args[2:])
+			return
+		case "components":
+			runComponents(os.Args[2:])
+			return
+		}
+	}
+
+	common := registerCommonFlags(flag.CommandLine)
+	common.registerOutputFlags("html")
 
-	fmt.Printf("Dependency graph has been generated in %s\n", outputPath)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s query [options] <expression> [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s unused [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s types [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s hotspots -cover <profiles> [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s coupling [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s components [options] [working_directory]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nGenerates a dependency graph visualization for a Go project.\n")
+		fmt.Fprintf(os.Stderr, "\nArguments:\n")
+		fmt.Fprintf(os.Stderr, "  working_directory    The root directory of the Go project (default: current directory)\n")
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	workDir := "."
+	if flag.NArg() > 0 {
+		workDir = flag.Arg(0)
+	}
+	absWorkDir, cfg := common.setup(workDir)
+
+	data := common.buildGraph(cfg)
+
+	// Create output files relative to the working directory
+	outputs := cfg.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Path: "dependency_graph.html"}}
+	}
+	if err := writeOutputs(absWorkDir, outputs, common.format, data); err != nil {
+		log.Fatal(err)
+	}
+
+	// Report architecture rule violations; they do not fail the run
+	violations, err := checkRules(data, cfg.Rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, v := range violations {
+		fmt.Fprintf(os.Stderr, "Warning: rule violation (%s): %s imports %s\n", v.Rule, v.Source, v.Target)
+	}
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d architecture rule violation(s)\n", len(violations))
+	}
 }
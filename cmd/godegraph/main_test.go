@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestModuleForImportPath(t *testing.T) {
+	modules := []ModuleInfo{
+		{ModulePath: "example.com/foo"},
+		{ModulePath: "example.com/foo/tools"},
+		{ModulePath: "example.com/foobar"},
+	}
+	tests := []struct {
+		importPath string
+		want       string
+		ok         bool
+	}{
+		{"example.com/foo", "example.com/foo", true},
+		{"example.com/foo/internal/db", "example.com/foo", true},
+		{"example.com/foo/tools", "example.com/foo/tools", true},
+		{"example.com/foo/tools/gen", "example.com/foo/tools", true},
+		{"example.com/foo/toolsx", "example.com/foo", true},
+		{"example.com/foobar/api", "example.com/foobar", true},
+		{"example.com/foob", "", false},
+		{"example.com", "", false},
+		{"fmt", "", false},
+	}
+	for _, tt := range tests {
+		mod, ok := moduleForImportPath(tt.importPath, modules)
+		if mod.ModulePath != tt.want || ok != tt.ok {
+			t.Errorf("moduleForImportPath(%q) = %q, %v, want %q, %v", tt.importPath, mod.ModulePath, ok, tt.want, tt.ok)
+		}
+	}
+
+	// The order of the modules does not matter
+	reversed := []ModuleInfo{modules[2], modules[1], modules[0]}
+	if mod, _ := moduleForImportPath("example.com/foo/tools/gen", reversed); mod.ModulePath != "example.com/foo/tools" {
+		t.Errorf("nested module lost to its parent: %q", mod.ModulePath)
+	}
+}
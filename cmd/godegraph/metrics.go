@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PackageMetrics describes the size and complexity of a package. Test
+// files only count towards TestFiles.
+type PackageMetrics struct {
+	Files      int     `json:"files"`
+	Lines      int     `json:"lines"`      // lines of code, without blank and comment-only lines
+	Exported   int     `json:"exported"`   // exported package-level identifiers and methods
+	TestFiles  int     `json:"testFiles"`  // internal and external test files
+	Complexity float64 `json:"complexity"` // average cyclomatic complexity of functions and methods
+}
+
+// metricNames are the metrics the viewer can size nodes by.
+var metricNames = []string{"files", "lines", "exported", "testFiles", "complexity"}
+
+// attachMetrics computes the metrics of every package node. Files that
+// fail to parse are reported as warnings and left out.
+func attachMetrics(graph *Graph) {
+	for i, node := range graph.Nodes {
+		pkg, ok := graph.packages[node.ID]
+		if !ok {
+			continue
+		}
+		metrics, err := packageMetrics(pkg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", node.ID, err)
+		}
+		graph.Nodes[i].Metrics = metrics
+	}
+}
+
+// packageMetrics parses the non-test files of pkg and computes its metrics.
+func packageMetrics(pkg Package) (*PackageMetrics, error) {
+	metrics := &PackageMetrics{TestFiles: len(pkg.TestGoFiles) + len(pkg.XTestGoFiles)}
+	fset := token.NewFileSet()
+	var firstErr error
+	functions, complexity := 0, 0
+	for _, name := range append(append([]string(nil), pkg.GoFiles...), pkg.CgoFiles...) {
+		src, err := os.ReadFile(filepath.Join(pkg.Dir, name))
+		if err == nil {
+			var file *ast.File
+			if file, err = parser.ParseFile(fset, name, src, parser.ParseComments); err == nil {
+				metrics.Files++
+				metrics.Lines += countCodeLines(fset, file, src)
+				metrics.Exported += countExported(file)
+				for _, decl := range file.Decls {
+					if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+						functions++
+						complexity += cyclomaticComplexity(fn.Body)
+					}
+				}
+				continue
+			}
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("failed to parse %s: %v", name, err)
+		}
+	}
+	if functions > 0 {
+		metrics.Complexity = float64(complexity) / float64(functions)
+	}
+	return metrics, firstErr
+}
+
+// countCodeLines counts the lines of src that are neither blank nor
+// covered by comments only. Positions ignore //line directives, which
+// refer to the lines of another file.
+func countCodeLines(fset *token.FileSet, file *ast.File, src []byte) int {
+	lines := bytes.Split(src, []byte("\n"))
+	commentOnly := make([]bool, len(lines))
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			start := fset.PositionFor(c.Pos(), false)
+			end := fset.PositionFor(c.End(), false)
+			for line := start.Line; line <= end.Line; line++ {
+				// A line is comment-only if nothing but spaces surrounds the comment
+				text := string(lines[line-1])
+				if line == start.Line {
+					if strings.TrimSpace(text[:start.Column-1]) != "" {
+						continue
+					}
+				}
+				if line == end.Line {
+					if strings.TrimSpace(text[end.Column-1:]) != "" {
+						continue
+					}
+				}
+				commentOnly[line-1] = true
+			}
+		}
+	}
+
+	count := 0
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) > 0 && !commentOnly[i] {
+			count++
+		}
+	}
+	return count
+}
+
+// countExported counts the exported package-level identifiers of file and
+// the exported methods declared in it.
+func countExported(file *ast.File) int {
+	count := 0
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Name.IsExported() {
+				count++
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						count++
+					}
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							count++
+						}
+					}
+				}
+			}
+		}
+	}
+	return count
+}
+
+// cyclomaticComplexity returns 1 plus the number of decision points in
+// body: conditions, loops, non-default cases and boolean operators.
+// Function literals count towards the enclosing function.
+func cyclomaticComplexity(body *ast.BlockStmt) int {
+	complexity := 1
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if n.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
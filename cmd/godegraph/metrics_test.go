@@ -0,0 +1,133 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCountCodeLines(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int
+	}{
+		{
+			name: "blank and comment lines",
+			src:  "package p\n\n// Doc comment\nfunc F() {}\n",
+			want: 2,
+		},
+		{
+			name: "trailing comment",
+			src:  "package p\n\nvar x = 1 // one\n",
+			want: 2,
+		},
+		{
+			name: "block comment",
+			src:  "package p\n\n/*\nlong\ncomment\n*/\nvar x = 1\n",
+			want: 2,
+		},
+		{
+			name: "line directive past the end of the file",
+			src:  "package p\n\n//line gen.y:500\n// generated\nvar x = 1\n",
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "p.go", tt.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := countCodeLines(fset, file, []byte(tt.src)); got != tt.want {
+				t.Errorf("countCodeLines() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountExported(t *testing.T) {
+	src := `package p
+
+type T struct{ Field int }
+type t struct{}
+
+func (T) Method() {}
+func (T) method() {}
+func F()          {}
+
+var A, b, C = 1, 2, 3
+
+const (
+	D = iota
+	e
+)
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// T, Method, F, A, C and D; fields are not package-level
+	if got := countExported(file); got != 6 {
+		t.Errorf("countExported() = %d, want 6", got)
+	}
+}
+
+func TestCyclomaticComplexity(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"", 1},
+		{"if a && b || c {}", 4},
+		{"for i := range xs { if i > 0 {} }", 3},
+		{"for {}", 2},
+		{"switch x { case 1, 2: case 3: default: }", 3},
+		{"select { case <-ch: default: }", 2},
+		{"f := func() { if a {} }; f()", 2},
+	}
+	for _, tt := range tests {
+		src := "package p\n\nfunc f() {\n" + tt.body + "\n}\n"
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.body, err)
+		}
+		body := file.Decls[0].(*ast.FuncDecl).Body
+		if got := cyclomaticComplexity(body); got != tt.want {
+			t.Errorf("cyclomaticComplexity(%q) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPackageMetrics(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go":      "package p\n\n// F does nothing\nfunc F(a bool) {\n\tif a {\n\t}\n}\n",
+		"b.go":      "package p\n\nfunc g() {}\n\nvar V = 1\n",
+		"broken.go": "package p\n\nfunc {\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkg := Package{
+		Dir:          dir,
+		GoFiles:      []string{"a.go", "b.go", "broken.go"},
+		TestGoFiles:  []string{"a_test.go"},
+		XTestGoFiles: []string{"x_test.go", "y_test.go"},
+	}
+	metrics, err := packageMetrics(pkg)
+	if err == nil {
+		t.Error("packageMetrics() did not report broken.go")
+	}
+	want := &PackageMetrics{Files: 2, Lines: 8, Exported: 2, TestFiles: 3, Complexity: 1.5}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("packageMetrics() = %+v, want %+v", metrics, want)
+	}
+}
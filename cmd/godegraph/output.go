@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outputFormats lists the supported output formats.
+var outputFormats = []string{"html", "json", "dot", "dsm", "csv", "svg"}
+
+// stdoutPath is the output path that stands for standard output.
+const stdoutPath = "-"
+
+// outputFormat returns the format of an output. Unless set explicitly, it
+// is derived from the file extension, falling back to fallback for stdout
+// and unknown extensions.
+func outputFormat(output OutputConfig, fallback string) (string, error) {
+	format := output.Format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(output.Path)) {
+		case ".html", ".htm":
+			format = "html"
+		case ".json":
+			format = "json"
+		case ".dot", ".gv":
+			format = "dot"
+		case ".dsm":
+			format = "dsm"
+		case ".csv":
+			format = "csv"
+		case ".svg":
+			format = "svg"
+		default:
+			if fallback == "" {
+				return "", fmt.Errorf("cannot derive output format from %q, set it explicitly", output.Path)
+			}
+			format = fallback
+		}
+	}
+	if !isOutputFormat(format) {
+		return "", fmt.Errorf("unknown output format %q (supported: %s)", format, strings.Join(outputFormats, ", "))
+	}
+	return format, nil
+}
+
+func isOutputFormat(format string) bool {
+	for _, known := range outputFormats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+// outputList collects repeated -o flags of the form [format:]path.
+type outputList []OutputConfig
+
+func (o *outputList) String() string {
+	var items []string
+	for _, output := range *o {
+		items = append(items, output.Path)
+	}
+	return strings.Join(items, ",")
+}
+
+func (o *outputList) Set(value string) error {
+	output := OutputConfig{Path: value}
+	if format, path, ok := strings.Cut(value, ":"); ok && isOutputFormat(format) {
+		output = OutputConfig{Path: path, Format: format}
+	}
+	if output.Path == "" {
+		return fmt.Errorf("empty output path")
+	}
+	*o = append(*o, output)
+	return nil
+}
+
+// writeOutputs renders graph to each of the outputs. Relative paths are
+// resolved against rootDir and "-" writes to stdout.
+func writeOutputs(rootDir string, outputs []OutputConfig, fallbackFormat string, graph *Graph) error {
+	for _, output := range outputs {
+		format, err := outputFormat(output, fallbackFormat)
+		if err != nil {
+			return err
+		}
+
+		if output.Path == stdoutPath {
+			if err := writeGraph(os.Stdout, format, graph); err != nil {
+				return fmt.Errorf("failed to write %s output to stdout: %v", format, err)
+			}
+			continue
+		}
+
+		outputPath := resolvePath(rootDir, output.Path)
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		if err := writeGraph(f, format, graph); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %v", outputPath, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %v", outputPath, err)
+		}
+		fmt.Fprintf(os.Stderr, "Dependency graph has been generated in %s\n", outputPath)
+	}
+	return nil
+}
+
+// writeGraph renders graph in the given format.
+func writeGraph(w io.Writer, format string, graph *Graph) error {
+	switch format {
+	case "html":
+		return writeHTML(w, graph)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graph)
+	case "dot":
+		return writeDOT(w, graph)
+	case "dsm":
+		return writeDSM(w, graph)
+	case "csv":
+		return writeDSMCSV(w, graph)
+	case "svg":
+		return writeSVG(w, graph)
+	}
+	return fmt.Errorf("unknown output format %q (supported: %s)", format, strings.Join(outputFormats, ", "))
+}
+
+// writeHTML renders the interactive viewer.
+func writeHTML(w io.Writer, graph *Graph) error {
+	jsonData, err := json.Marshal(graph)
+	if err != nil {
+		return err
+	}
+
+	tmpl := template.Must(template.New("graph").Parse(htmlTemplate))
+	return tmpl.Execute(w, string(jsonData))
+}
+
+// writeDOT renders the graph in Graphviz DOT format, one cluster per module
+// and, in type graphs, one nested cluster per package.
+func writeDOT(w io.Writer, graph *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph dependencies {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=filled, fontname=\"Arial\"];\n")
+
+	modules := make(map[string]ModuleInfo)
+	for _, mod := range graph.Modules {
+		modules[mod.ModulePath] = mod
+	}
+
+	nodesByModule := make(map[string][]Node)
+	var moduleOrder []string
+	for _, node := range graph.Nodes {
+		if _, ok := nodesByModule[node.Module]; !ok {
+			moduleOrder = append(moduleOrder, node.Module)
+		}
+		nodesByModule[node.Module] = append(nodesByModule[node.Module], node)
+	}
+	sort.Strings(moduleOrder)
+
+	for i, modPath := range moduleOrder {
+		color := modules[modPath].Color
+		if color == "" {
+			color = "#f8f9fa"
+		}
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&b, "    label=%q;\n", modPath)
+
+		// Type graph nodes are further grouped by package
+		var packageOrder []string
+		nodesByPackage := make(map[string][]Node)
+		for _, node := range nodesByModule[modPath] {
+			if node.Package == "" {
+				fmt.Fprintf(&b, "    %q [fillcolor=%q];\n", node.ID, color)
+				continue
+			}
+			if _, ok := nodesByPackage[node.Package]; !ok {
+				packageOrder = append(packageOrder, node.Package)
+			}
+			nodesByPackage[node.Package] = append(nodesByPackage[node.Package], node)
+		}
+		for j, pkgPath := range packageOrder {
+			fmt.Fprintf(&b, "    subgraph cluster_%d_%d {\n", i, j)
+			fmt.Fprintf(&b, "      label=%q;\n", pkgPath)
+			for _, node := range nodesByPackage[pkgPath] {
+				name := strings.TrimPrefix(node.ID, pkgPath+".")
+				fmt.Fprintf(&b, "      %q [label=%q, fillcolor=%q];\n", node.ID, name, color)
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("  }\n")
+	}
+
+	for _, link := range graph.Links {
+		var attrs []string
+		labels := append(append([]string(nil), link.Kinds...), link.Configs...)
+		if link.Calls > 0 {
+			labels = append(labels, fmt.Sprintf("%d calls", link.Calls))
+		}
+		if link.Weight > 0 {
+			labels = append(labels, fmt.Sprintf("%d imports", link.Weight))
+		}
+		if len(labels) > 0 {
+			attrs = append(attrs, fmt.Sprintf("label=%q", strings.Join(labels, "\n")))
+		}
+		if len(link.Kinds) == 1 && link.Kinds[0] == typeLinkImplements {
+			attrs = append(attrs, "style=dashed")
+		}
+		if graph.CallGraph != "" {
+			if link.Calls == 0 {
+				attrs = append(attrs, "style=dotted")
+			} else {
+				attrs = append(attrs, fmt.Sprintf("penwidth=%.1f", math.Min(1+math.Log2(1+float64(link.Calls)), 8)))
+			}
+		}
+		if link.Critical {
+			// Imports on the critical path of the build
+			attrs = append(attrs, `color="#8e44ad"`)
+			if graph.CallGraph == "" {
+				attrs = append(attrs, "penwidth=3")
+			}
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, "  %q -> %q [%s];\n", link.Source, link.Target, strings.Join(attrs, ", "))
+			continue
+		}
+		fmt.Fprintf(&b, "  %q -> %q;\n", link.Source, link.Target)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
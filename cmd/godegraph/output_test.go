@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		output   OutputConfig
+		fallback string
+		want     string
+		err      bool
+	}{
+		{OutputConfig{Path: "deps.html"}, "", "html", false},
+		{OutputConfig{Path: "deps.HTM"}, "", "html", false},
+		{OutputConfig{Path: "graph.gv"}, "", "dot", false},
+		{OutputConfig{Path: "deps.csv"}, "", "csv", false},
+		{OutputConfig{Path: "deps.txt", Format: "dsm"}, "", "dsm", false},
+		{OutputConfig{Path: "-"}, "json", "json", false},
+		{OutputConfig{Path: "-"}, "", "", true},
+		{OutputConfig{Path: "deps.png"}, "", "", true},
+		{OutputConfig{Path: "deps.html", Format: "png"}, "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := outputFormat(tt.output, tt.fallback)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("outputFormat(%+v, %q) = %q, %v", tt.output, tt.fallback, got, err)
+		}
+	}
+}
+
+func TestOutputListSet(t *testing.T) {
+	var outputs outputList
+	for _, value := range []string{"deps.html", "dot:-", "json:out/graph", `C:\deps.svg`} {
+		if err := outputs.Set(value); err != nil {
+			t.Fatalf("Set(%q): %v", value, err)
+		}
+	}
+	want := outputList{
+		{Path: "deps.html"},
+		{Path: "-", Format: "dot"},
+		{Path: "out/graph", Format: "json"},
+		{Path: `C:\deps.svg`},
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %+v, want %+v", outputs, want)
+	}
+	if got := outputs.String(); got != `deps.html,-,out/graph,C:\deps.svg` {
+		t.Errorf("String() = %q", got)
+	}
+	for _, value := range []string{"", "dot:"} {
+		if err := outputs.Set(value); err == nil {
+			t.Errorf("Set(%q) accepted an empty path", value)
+		}
+	}
+}
+
+func TestWriteOutputs(t *testing.T) {
+	dir := t.TempDir()
+	graph := &Graph{Nodes: []Node{{ID: "a", Module: "a"}}}
+	outputs := []OutputConfig{{Path: "deps.json"}, {Path: "deps", Format: "dot"}}
+	if err := writeOutputs(dir, outputs, "", graph); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "deps.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Graph
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Nodes) != 1 {
+		t.Errorf("deps.json = %s, %v", data, err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "deps"))
+	if err != nil || !strings.HasPrefix(string(data), "digraph dependencies {") {
+		t.Errorf("deps = %s, %v", data, err)
+	}
+	if err := writeOutputs(dir, []OutputConfig{{Path: "deps.png"}}, "", graph); err == nil {
+		t.Error("writeOutputs() accepted an unknown format")
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	graph := &Graph{
+		Nodes: []Node{
+			{ID: "lib", Module: "lib"},
+			{ID: "app/api", Module: "app"},
+			{ID: "app/api.Server", Package: "app/api", Module: "app"},
+		},
+		Links: []Link{
+			{Source: "app/api", Target: "lib", Weight: 2},
+			{Source: "app/api.Server", Target: "lib", Kinds: []string{typeLinkImplements}, Critical: true},
+		},
+		Modules: []ModuleInfo{{ModulePath: "app", Color: "#3498db"}},
+	}
+	var b strings.Builder
+	if err := writeDOT(&b, graph); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph dependencies {
+  rankdir=LR;
+  node [shape=box, style=filled, fontname="Arial"];
+  subgraph cluster_0 {
+    label="app";
+    "app/api" [fillcolor="#3498db"];
+    subgraph cluster_0_0 {
+      label="app/api";
+      "app/api.Server" [label="Server", fillcolor="#3498db"];
+    }
+  }
+  subgraph cluster_1 {
+    label="lib";
+    "lib" [fillcolor="#f8f9fa"];
+  }
+  "app/api" -> "lib" [label="2 imports"];
+  "app/api.Server" -> "lib" [label="implements", style=dashed, color="#8e44ad", penwidth=3];
+}
+`
+	if b.String() != want {
+		t.Errorf("writeDOT() =\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// ProfileInfo describes the profile the samples of nodes and links come from.
+type ProfileInfo struct {
+	SampleType string `json:"sampleType"` // e.g. cpu
+	Unit       string `json:"unit"`       // e.g. nanoseconds
+	Total      int64  `json:"total"`      // sum over all samples, including other packages
+}
+
+// Samples are the profile values attributed to a package.
+type Samples struct {
+	Flat int64 `json:"flat"` // in functions of the package
+	Cum  int64 `json:"cum"`  // in functions of the package and everything they call
+}
+
+// attachProfile reads a pprof profile and attributes its samples to the
+// package nodes, using the default sample type (the last one if unset).
+// Frames of other packages are skipped, so the flow on a link includes
+// calls through external code, e.g. callbacks from the standard library.
+// Flow between packages without an import link is not recorded.
+func attachProfile(graph *Graph, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open profile: %v", err)
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse profile %s: %v", filename, err)
+	}
+	if len(p.SampleType) == 0 {
+		return fmt.Errorf("profile %s has no sample types", filename)
+	}
+
+	valueIndex := len(p.SampleType) - 1
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			valueIndex = i
+		}
+	}
+	info := &ProfileInfo{SampleType: p.SampleType[valueIndex].Type, Unit: p.SampleType[valueIndex].Unit}
+
+	nodes := make(map[string]int)
+	dirs := make(map[string]string)
+	for i, node := range graph.Nodes {
+		nodes[node.ID] = i
+		if pkg, ok := graph.packages[node.ID]; ok {
+			dirs[filepath.ToSlash(pkg.Dir)] = node.ID
+		}
+	}
+	links := make(map[linkKey]int)
+	for i, link := range graph.Links {
+		links[linkKey{link.Source, link.Target}] = i
+	}
+
+	samples := make(map[int]*Samples)
+	flow := make(map[int]int64)
+	for _, sample := range p.Sample {
+		value := sample.Value[valueIndex]
+		info.Total += value
+
+		// Packages of the frames, leaf first; inlined calls are frames too
+		var frames []string
+		for _, loc := range sample.Location {
+			for _, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				pkg := profilePackage(line.Function, nodes, dirs)
+				if pkg != "" {
+					frames = append(frames, pkg)
+				}
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+
+		if isLeafFrame(sample.Location[0], frames[0], nodes, dirs) {
+			samplesOf(samples, nodes[frames[0]]).Flat += value
+		}
+		seen := make(map[string]bool)
+		seenLinks := make(map[int]bool)
+		for i, pkg := range frames {
+			if !seen[pkg] {
+				seen[pkg] = true
+				samplesOf(samples, nodes[pkg]).Cum += value
+			}
+			// frames[i+1] calls frames[i]
+			if i+1 < len(frames) && frames[i+1] != pkg {
+				if idx, ok := links[linkKey{frames[i+1], pkg}]; ok && !seenLinks[idx] {
+					seenLinks[idx] = true
+					flow[idx] += value
+				}
+			}
+		}
+	}
+
+	for idx, s := range samples {
+		graph.Nodes[idx].Samples = s
+	}
+	for idx, value := range flow {
+		graph.Links[idx].Samples = value
+	}
+	graph.Profile = info
+	return nil
+}
+
+// samplesOf returns the samples of the node at idx, creating them if needed.
+func samplesOf(samples map[int]*Samples, idx int) *Samples {
+	s, ok := samples[idx]
+	if !ok {
+		s = &Samples{}
+		samples[idx] = s
+	}
+	return s
+}
+
+// isLeafFrame reports whether the innermost function of loc belongs to pkg,
+// i.e. whether the sample was taken in pkg itself.
+func isLeafFrame(loc *profile.Location, pkg string, nodes map[string]int, dirs map[string]string) bool {
+	return len(loc.Line) > 0 && loc.Line[0].Function != nil && profilePackage(loc.Line[0].Function, nodes, dirs) == pkg
+}
+
+// profilePackage returns the package node of a profiled function, or ""
+// if it is not one of the graph's packages. Symbols of main packages are
+// prefixed "main." whatever their import path, so these are mapped by the
+// directory of their source file.
+func profilePackage(fn *profile.Function, nodes map[string]int, dirs map[string]string) string {
+	pkg := symbolPackage(fn.Name)
+	if _, ok := nodes[pkg]; ok {
+		return pkg
+	}
+	if fn.Filename != "" {
+		return dirs[filepath.ToSlash(filepath.Dir(fn.Filename))]
+	}
+	return ""
+}
+
+// symbolPackage returns the package path of a Go symbol name like
+// "example.com/foo/bar.(*T).Method[...]": everything up to the first dot
+// after the last slash, ignoring type arguments. Dots in the last path
+// element are escaped by the linker, as in "gopkg.in/yaml%2ev3.Marshal",
+// sometimes twice.
+func symbolPackage(name string) string {
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	pkg := name[:slash+1+dot]
+	for strings.Contains(pkg, "%") {
+		unescaped, err := url.PathUnescape(pkg)
+		if err != nil || unescaped == pkg {
+			break
+		}
+		pkg = unescaped
+	}
+	return pkg
+}
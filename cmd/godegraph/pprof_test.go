@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestSymbolPackage(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main.main", "main"},
+		{"fmt.Println", "fmt"},
+		{"example.com/foo/bar.(*T).Method", "example.com/foo/bar"},
+		{"example.com/foo/bar.Map[...]", "example.com/foo/bar"},
+		{"example.com/foo/bar.Map[go.shape.int]", "example.com/foo/bar"},
+		{"gopkg.in/yaml%2ev3.(*Decoder).Decode", "gopkg.in/yaml.v3"},
+		{"gopkg.in/yaml%252ev3.Marshal", "gopkg.in/yaml.v3"},
+		{"k8s.io/api/core/v1%2ebeta.Pod.String", "k8s.io/api/core/v1.beta"},
+		{"runtime", ""},
+	}
+	for _, tt := range tests {
+		if got := symbolPackage(tt.name); got != tt.want {
+			t.Errorf("symbolPackage(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writeTestProfile writes a profile with the given stacks, leaf first, and
+// values of the "samples" and "cpu" sample types.
+func writeTestProfile(t *testing.T, defaultType string, stacks [][][]*profile.Function, values []int64) string {
+	t.Helper()
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		DefaultSampleType: defaultType,
+	}
+	functions := make(map[*profile.Function]bool)
+	for i, stack := range stacks {
+		sample := &profile.Sample{Value: []int64{1, values[i]}}
+		for _, inlined := range stack {
+			loc := &profile.Location{ID: uint64(len(p.Location) + 1)}
+			for _, fn := range inlined {
+				if !functions[fn] {
+					functions[fn] = true
+					fn.ID = uint64(len(p.Function) + 1)
+					p.Function = append(p.Function, fn)
+				}
+				loc.Line = append(loc.Line, profile.Line{Function: fn})
+			}
+			p.Location = append(p.Location, loc)
+			sample.Location = append(sample.Location, loc)
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	filename := filepath.Join(t.TempDir(), "cpu.pprof")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestAttachProfile(t *testing.T) {
+	cmdDir := filepath.Join(t.TempDir(), "cmd")
+	handle := &profile.Function{Name: "example.com/app/api.Handle"}
+	query := &profile.Function{Name: "example.com/app/db.Query"}
+	scan := &profile.Function{Name: "example.com/app/db.scan"}
+	serve := &profile.Function{Name: "net/http.(*conn).serve"}
+	malloc := &profile.Function{Name: "runtime.mallocgc"}
+	mainFn := &profile.Function{Name: "main.main", Filename: filepath.Join(cmdDir, "main.go")}
+	stacks := [][][]*profile.Function{
+		// Through the standard library, from a main package
+		{{query}, {serve}, {handle}, {mainFn}},
+		// With scan inlined into Query
+		{{scan, query}, {handle}},
+		// In the runtime on behalf of api
+		{{malloc}, {handle}},
+		// Outside of the graph's packages
+		{{malloc}},
+		// Without an import link
+		{{handle}, {query}},
+	}
+	values := []int64{10, 5, 7, 3, 2}
+
+	newGraph := func() *Graph {
+		return &Graph{
+			Nodes: []Node{
+				{ID: "example.com/app/cmd"},
+				{ID: "example.com/app/api"},
+				{ID: "example.com/app/db"},
+			},
+			Links: []Link{
+				{Source: "example.com/app/cmd", Target: "example.com/app/api"},
+				{Source: "example.com/app/api", Target: "example.com/app/db"},
+			},
+			packages: map[string]Package{"example.com/app/cmd": {Dir: cmdDir}},
+		}
+	}
+
+	graph := newGraph()
+	if err := attachProfile(graph, writeTestProfile(t, "", stacks, values)); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&ProfileInfo{SampleType: "cpu", Unit: "nanoseconds", Total: 27}); !reflect.DeepEqual(graph.Profile, want) {
+		t.Errorf("profile = %+v, want %+v", graph.Profile, want)
+	}
+	wantSamples := []*Samples{{Flat: 0, Cum: 10}, {Flat: 2, Cum: 24}, {Flat: 15, Cum: 17}}
+	for i, node := range graph.Nodes {
+		if !reflect.DeepEqual(node.Samples, wantSamples[i]) {
+			t.Errorf("samples of %s = %+v, want %+v", node.ID, node.Samples, wantSamples[i])
+		}
+	}
+	for i, want := range []int64{10, 15} {
+		if got := graph.Links[i].Samples; got != want {
+			t.Errorf("samples of %s -> %s = %d, want %d", graph.Links[i].Source, graph.Links[i].Target, got, want)
+		}
+	}
+
+	// The default sample type is used if the profile has one
+	graph = newGraph()
+	if err := attachProfile(graph, writeTestProfile(t, "samples", stacks, values)); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&ProfileInfo{SampleType: "samples", Unit: "count", Total: 5}); !reflect.DeepEqual(graph.Profile, want) {
+		t.Errorf("profile = %+v, want %+v", graph.Profile, want)
+	}
+
+	filename := filepath.Join(t.TempDir(), "bad.pprof")
+	if err := os.WriteFile(filename, []byte("not a profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := attachProfile(newGraph(), filename); err == nil {
+		t.Error("attachProfile() accepted an invalid profile")
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A query is a small set-algebra expression evaluated against a Graph,
+// modelled after Bazel query. Examples:
+//
+//	deps(myorg/api/...) - deps(myorg/legacy/...)
+//	rdeps(myorg/api/auth, 2)
+//	module(foo) & imports(bar)
+//
+// Grammar:
+//
+//	expr    = term { ("+" | "|" | "-") term }
+//	term    = factor { "&" factor }
+//	factor  = "(" expr ")" | call | pattern
+//	call    = name "(" expr [ "," expr ] ")"
+//	pattern = word | quoted string
+//
+// A pattern matches package import paths; "..." matches any string, so
+// "foo/..." matches foo and everything below it, and "*" matches within a
+// single path element.
+
+// nodeSet is a set of package import paths.
+type nodeSet map[string]bool
+
+// graphIndex holds adjacency lists for evaluating queries against a Graph.
+type graphIndex struct {
+	graph      *Graph
+	nodes      map[string]Node
+	imports    map[string][]string
+	importedBy map[string][]string
+}
+
+func newGraphIndex(graph *Graph) *graphIndex {
+	ix := &graphIndex{
+		graph:      graph,
+		nodes:      make(map[string]Node),
+		imports:    make(map[string][]string),
+		importedBy: make(map[string][]string),
+	}
+	for _, node := range graph.Nodes {
+		ix.nodes[node.ID] = node
+	}
+	for _, link := range graph.Links {
+		ix.imports[link.Source] = append(ix.imports[link.Source], link.Target)
+		ix.importedBy[link.Target] = append(ix.importedBy[link.Target], link.Source)
+	}
+	return ix
+}
+
+// reach returns the nodes reachable from start by following edges for at
+// most depth steps. A negative depth means unlimited.
+func (ix *graphIndex) reach(start nodeSet, edges map[string][]string, depth int) nodeSet {
+	result := make(nodeSet)
+	var frontier []string
+	for id := range start {
+		result[id] = true
+		frontier = append(frontier, id)
+	}
+	for level := 0; len(frontier) > 0 && (depth < 0 || level < depth); level++ {
+		var next []string
+		for _, id := range frontier {
+			for _, neighbor := range edges[id] {
+				if !result[neighbor] {
+					result[neighbor] = true
+					next = append(next, neighbor)
+				}
+			}
+		}
+		frontier = next
+	}
+	return result
+}
+
+type queryExpr interface {
+	eval(ix *graphIndex) (nodeSet, error)
+}
+
+type patternExpr struct {
+	pattern string
+}
+
+type binaryExpr struct {
+	op          string
+	left, right queryExpr
+}
+
+type callExpr struct {
+	name  string
+	args  []queryExpr
+	depth int
+}
+
+// matchPattern compiles a package pattern into a matcher function.
+// It follows the "go list" rules: "..." matches any string and a
+// trailing "/..." also matches the prefix itself. "*" matches within a
+// single path element.
+func matchPattern(pattern string) func(string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	re = strings.ReplaceAll(re, `\*`, `[^/]*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	compiled := regexp.MustCompile(`^` + re + `$`)
+	return compiled.MatchString
+}
+
+func (e *patternExpr) eval(ix *graphIndex) (nodeSet, error) {
+	match := matchPattern(e.pattern)
+	result := make(nodeSet)
+	for id := range ix.nodes {
+		if match(id) {
+			result[id] = true
+		}
+	}
+	return result, nil
+}
+
+func (e *binaryExpr) eval(ix *graphIndex) (nodeSet, error) {
+	left, err := e.left.eval(ix)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(ix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(nodeSet)
+	switch e.op {
+	case "+", "|":
+		for id := range left {
+			result[id] = true
+		}
+		for id := range right {
+			result[id] = true
+		}
+	case "-":
+		for id := range left {
+			if !right[id] {
+				result[id] = true
+			}
+		}
+	case "&":
+		for id := range left {
+			if right[id] {
+				result[id] = true
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", e.op)
+	}
+	return result, nil
+}
+
+func (e *callExpr) eval(ix *graphIndex) (nodeSet, error) {
+	if e.name == "module" {
+		// module() takes a module pattern rather than a package set
+		pattern, ok := e.args[0].(*patternExpr)
+		if !ok {
+			return nil, fmt.Errorf("module() expects a module pattern")
+		}
+		match := matchPattern(pattern.pattern)
+		modules := make(map[string]bool)
+		for _, mod := range ix.graph.Modules {
+			if match(mod.ModulePath) || match(mod.Name) || match(filepath.ToSlash(mod.Path)) {
+				modules[mod.ModulePath] = true
+			}
+		}
+		result := make(nodeSet)
+		for id, node := range ix.nodes {
+			if modules[node.Module] {
+				result[id] = true
+			}
+		}
+		return result, nil
+	}
+
+	args := make([]nodeSet, len(e.args))
+	for i, arg := range e.args {
+		set, err := arg.eval(ix)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = set
+	}
+
+	switch e.name {
+	case "deps":
+		return ix.reach(args[0], ix.imports, e.depth), nil
+	case "rdeps":
+		return ix.reach(args[0], ix.importedBy, e.depth), nil
+	case "imports":
+		// Packages that directly import any package of the argument
+		result := make(nodeSet)
+		for id := range args[0] {
+			for _, importer := range ix.importedBy[id] {
+				result[importer] = true
+			}
+		}
+		return result, nil
+	case "allpaths":
+		from := ix.reach(args[0], ix.imports, -1)
+		to := ix.reach(args[1], ix.importedBy, -1)
+		result := make(nodeSet)
+		for id := range from {
+			if to[id] {
+				result[id] = true
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unknown function %q", e.name)
+}
+
+// queryFunctions describes the accepted arguments of each query function.
+var queryFunctions = map[string]struct {
+	sets     int  // number of set arguments
+	hasDepth bool // whether an optional depth argument follows
+}{
+	"deps":     {sets: 1, hasDepth: true},
+	"rdeps":    {sets: 1, hasDepth: true},
+	"imports":  {sets: 1},
+	"module":   {sets: 1},
+	"allpaths": {sets: 2},
+}
+
+type queryToken struct {
+	kind string // "word", "op" or "eof"
+	text string
+	pos  int
+}
+
+// tokenizeQuery splits a query into words and operators. A "-" that
+// starts a token is the difference operator; inside a word it is part of
+// the package path.
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	isWordChar := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("/._-*~@", r)
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()+|-&,", r):
+			tokens = append(tokens, queryToken{kind: "op", text: string(r), pos: i})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, queryToken{kind: "word", text: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+		case isWordChar(r):
+			start := i
+			for i < len(runes) && isWordChar(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: "word", text: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	tokens = append(tokens, queryToken{kind: "eof", pos: len(runes)})
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// parseQuery parses a query expression.
+func parseQuery(input string) (queryExpr, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != "eof" {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return expr, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != "eof" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) expect(op string) error {
+	tok := p.next()
+	if tok.kind != "op" || tok.text != op {
+		if tok.kind == "eof" {
+			return fmt.Errorf("expected %q at end of query", op)
+		}
+		return fmt.Errorf("expected %q at position %d, found %q", op, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *queryParser) parseExpr() (queryExpr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != "op" || (tok.text != "+" && tok.text != "|" && tok.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseTerm() (queryExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "op" && p.peek().text == "&" {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseFactor() (queryExpr, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == "op" && tok.text == "(":
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case tok.kind == "word":
+		if next := p.peek(); next.kind == "op" && next.text == "(" {
+			return p.parseCall(tok)
+		}
+		return &patternExpr{pattern: tok.text}, nil
+	case tok.kind == "eof":
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *queryParser) parseCall(name queryToken) (queryExpr, error) {
+	fn, ok := queryFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	p.next() // "("
+
+	call := &callExpr{name: name.text, depth: -1}
+	for i := 0; i < fn.sets; i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+
+	if fn.hasDepth && p.peek().kind == "op" && p.peek().text == "," {
+		p.next()
+		tok := p.next()
+		depth, err := strconv.Atoi(tok.text)
+		if tok.kind != "word" || err != nil || depth < 0 {
+			return nil, fmt.Errorf("%s(): invalid depth %q at position %d", name.text, tok.text, tok.pos)
+		}
+		call.depth = depth
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// evaluateQuery parses and evaluates a query against graph and returns
+// the induced subgraph of the matching packages.
+func evaluateQuery(graph *Graph, query string) (*Graph, error) {
+	set, err := evalQuery(newGraphIndex(graph), query)
+	if err != nil {
+		return nil, err
+	}
+	return graph.subgraph(set), nil
+}
+
+// evalQuery parses and evaluates a query and returns the matching packages.
+func evalQuery(ix *graphIndex, query string) (nodeSet, error) {
+	expr, err := parseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+	set, err := expr.eval(ix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate query: %v", err)
+	}
+	return set, nil
+}
+
+// subgraph returns the part of the graph induced by the given packages.
+// Only modules that still own at least one package are kept; everything
+// else, like overlay information, is shared with g.
+func (g *Graph) subgraph(set nodeSet) *Graph {
+	sub := *g
+	sub.Nodes, sub.Links, sub.Modules = nil, nil, nil
+	usedModules := make(map[string]bool)
+	for _, node := range g.Nodes {
+		if set[node.ID] {
+			sub.Nodes = append(sub.Nodes, node)
+			usedModules[node.Module] = true
+		}
+	}
+	for _, link := range g.Links {
+		if set[link.Source] && set[link.Target] {
+			sub.Links = append(sub.Links, link)
+		}
+	}
+	for _, mod := range g.Modules {
+		if usedModules[mod.ModulePath] {
+			sub.Modules = append(sub.Modules, mod)
+		}
+	}
+	return &sub
+}
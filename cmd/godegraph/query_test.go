@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// queryVectors are the query test cases shared by the Go query engine and
+// its JavaScript copy in the viewer: a query either matches the packages
+// of want or fails with error.
+type queryVectors struct {
+	Graph *Graph `json:"graph"`
+	Tests []struct {
+		Query string   `json:"query"`
+		Want  []string `json:"want"`
+		Error string   `json:"error"`
+	} `json:"tests"`
+}
+
+func readQueryVectors(t *testing.T) *queryVectors {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "query.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors queryVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return &vectors
+}
+
+// queryResult is the outcome of a query as compared with the vectors.
+type queryResult struct {
+	Result []string `json:"result"`
+	Error  string   `json:"error"`
+}
+
+func TestQuery(t *testing.T) {
+	vectors := readQueryVectors(t)
+	ix := newGraphIndex(vectors.Graph)
+	for _, tt := range vectors.Tests {
+		var got queryResult
+		expr, err := parseQuery(tt.Query)
+		if err == nil {
+			var set nodeSet
+			if set, err = expr.eval(ix); err == nil {
+				got.Result = sortedKeys(set)
+			}
+		}
+		if err != nil {
+			got.Error = err.Error()
+		}
+		checkQueryResult(t, "Go", tt.Query, got, tt.Want, tt.Error)
+	}
+}
+
+// TestQueryJS runs the vectors through the query engine of the viewer.
+func TestQueryJS(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+	start := strings.Index(htmlTemplate, "// Query language, mirroring")
+	end := strings.Index(htmlTemplate, "// Create the hierarchy")
+	if start < 0 || end < start {
+		t.Fatal("query engine not found in the viewer")
+	}
+	vectorsPath, err := filepath.Abs(filepath.Join("testdata", "query.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := htmlTemplate[start:end] + `
+const vectors = JSON.parse(require("fs").readFileSync(process.argv[2], "utf8"));
+const results = vectors.tests.map(tt => {
+    try {
+        return {result: Array.from(evaluateQuery(parseQuery(tt.query), vectors.graph)).sort()};
+    } catch (err) {
+        return {error: err.message};
+    }
+});
+console.log(JSON.stringify(results));
+`
+	scriptPath := filepath.Join(t.TempDir(), "query.js")
+	if err := os.WriteFile(scriptPath, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(node, scriptPath, vectorsPath).Output()
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+
+	vectors := readQueryVectors(t)
+	var results []queryResult
+	if err := json.Unmarshal(out, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(vectors.Tests) {
+		t.Fatalf("got %d results for %d tests", len(results), len(vectors.Tests))
+	}
+	for i, tt := range vectors.Tests {
+		checkQueryResult(t, "JS", tt.Query, results[i], tt.Want, tt.Error)
+	}
+}
+
+func checkQueryResult(t *testing.T, engine, query string, got queryResult, want []string, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if got.Error != wantErr {
+			t.Errorf("%s: %q: error %q, want %q", engine, query, got.Error, wantErr)
+		}
+		return
+	}
+	if got.Error != "" {
+		t.Errorf("%s: %q: unexpected error %q", engine, query, got.Error)
+		return
+	}
+	sort.Strings(want)
+	if len(got.Result) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got.Result, want) {
+		t.Errorf("%s: %q = %v, want %v", engine, query, got.Result, want)
+	}
+}
+
+func TestSubgraph(t *testing.T) {
+	graph := &Graph{
+		Nodes: []Node{
+			{ID: "example.com/a/x", Module: "example.com/a"},
+			{ID: "example.com/a/y", Module: "example.com/a"},
+			{ID: "example.com/b", Module: "example.com/b"},
+		},
+		Links: []Link{
+			{Source: "example.com/a/x", Target: "example.com/a/y"},
+			{Source: "example.com/a/y", Target: "example.com/b"},
+		},
+		Modules:   []ModuleInfo{{ModulePath: "example.com/a"}, {ModulePath: "example.com/b"}},
+		Viewer:    &ViewerOptions{},
+		CallGraph: "static",
+		Profile:   &ProfileInfo{},
+		Binary:    &BinaryInfo{},
+		Build:     &BuildInfo{},
+	}
+	sub := graph.subgraph(nodeSet{"example.com/a/x": true, "example.com/a/y": true})
+
+	if len(sub.Nodes) != 2 || len(sub.Links) != 1 || len(sub.Modules) != 1 {
+		t.Errorf("subgraph has %d nodes, %d links and %d modules, want 2, 1 and 1", len(sub.Nodes), len(sub.Links), len(sub.Modules))
+	}
+	// Everything else is kept, overlays in particular
+	want, got := reflect.ValueOf(*graph), reflect.ValueOf(*sub)
+	for i := 0; i < want.NumField(); i++ {
+		field := want.Type().Field(i)
+		switch field.Name {
+		case "Nodes", "Links", "Modules":
+		default:
+			if field.IsExported() && !reflect.DeepEqual(got.Field(i).Interface(), want.Field(i).Interface()) {
+				t.Errorf("subgraph dropped %s", field.Name)
+			}
+		}
+	}
+}
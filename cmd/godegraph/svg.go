@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Dimensions of the static SVG rendering, in pixels
+const (
+	svgRowHeight   = 22
+	svgColumnWidth = 180
+	svgMargin      = 40
+	svgLabelWidth  = 320
+	svgLegendRow   = 18
+)
+
+// svgNode is a node of the package path tree laid out by writeSVG: a
+// package, a type or an intermediate folder.
+type svgNode struct {
+	id        string
+	name      string
+	module    string
+	isPackage bool
+	children  []*svgNode
+	depth     int
+	x, y      float64
+}
+
+// writeSVG renders a static picture of the graph for documentation, laid out
+// like the viewer: packages in a tree of their import paths, from left to
+// right, colored by module, with their imports drawn over the tree.
+func writeSVG(w io.Writer, graph *Graph) error {
+	root, nodes := svgTree(graph)
+	rows := svgLayout(root)
+
+	colors := make(map[string]string)
+	for _, mod := range graph.Modules {
+		colors[mod.ModulePath] = mod.Color
+	}
+	var modules []string
+	seen := make(map[string]bool)
+	for _, node := range graph.Nodes {
+		if !seen[node.Module] {
+			seen[node.Module] = true
+			modules = append(modules, node.Module)
+		}
+	}
+
+	maxDepth := 0
+	for _, n := range nodes {
+		maxDepth = max(maxDepth, n.depth)
+	}
+	top := float64(svgMargin + len(modules)*svgLegendRow + svgMargin)
+	width := svgMargin + maxDepth*svgColumnWidth + svgLabelWidth
+	height := int(top) + rows*svgRowHeight + svgMargin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"Arial, sans-serif\">\n", width, height, width, height)
+	fmt.Fprintf(&b, "  <rect width=\"100%%\" height=\"100%%\" fill=\"#f8f9fa\"/>\n")
+
+	// Legend of the module colors
+	b.WriteString("  <g class=\"legend\" font-size=\"12\">\n")
+	for i, module := range modules {
+		y := svgMargin + i*svgLegendRow
+		fmt.Fprintf(&b, "    <circle cx=\"%d\" cy=\"%d\" r=\"6\" fill=\"%s\" stroke=\"%s\" stroke-width=\"2\"/>\n",
+			svgMargin, y, svgFill(colors[module]), svgStroke(colors[module]))
+		fmt.Fprintf(&b, "    <text x=\"%d\" y=\"%d\" dy=\"0.35em\" fill=\"#333\">%s</text>\n", svgMargin+14, y, html.EscapeString(module))
+	}
+	b.WriteString("  </g>\n")
+
+	fmt.Fprintf(&b, "  <g transform=\"translate(%d,%s)\">\n", svgMargin, svgNumber(top))
+
+	// Tree links
+	b.WriteString("    <g class=\"links\" fill=\"none\" stroke=\"#ccc\">\n")
+	for _, n := range nodes {
+		for _, child := range n.children {
+			fmt.Fprintf(&b, "      <path d=\"%s\"/>\n", svgLinkPath(n, child))
+		}
+	}
+	b.WriteString("    </g>\n")
+
+	// Imports, in green as in the viewer without a selection, and the
+	// critical path of the build on top of them
+	byID := make(map[string]*svgNode)
+	for _, n := range nodes {
+		byID[n.id] = n
+	}
+	var critical []string
+	b.WriteString("    <g class=\"dependency-links\" fill=\"none\" stroke=\"#27ae60\" opacity=\"0.4\" stroke-opacity=\"0.4\">\n")
+	for _, link := range graph.Links {
+		source, target := byID[link.Source], byID[link.Target]
+		if source == nil || target == nil {
+			continue
+		}
+		var attrs []string
+		if len(link.Kinds) == 1 && link.Kinds[0] == typeLinkImplements {
+			attrs = append(attrs, `stroke-dasharray="4,3"`)
+		}
+		if graph.CallGraph != "" {
+			if link.Calls == 0 {
+				attrs = append(attrs, `stroke-dasharray="1,3"`)
+			} else {
+				attrs = append(attrs, fmt.Sprintf(`stroke-width="%s"`, svgNumber(math.Min(1.5+math.Log2(1+float64(link.Calls)), 8))))
+			}
+		}
+		style := ""
+		if len(attrs) > 0 {
+			style = " " + strings.Join(attrs, " ")
+		}
+		fmt.Fprintf(&b, "      <path d=\"%s\"%s/>\n", svgLinkPath(source, target), style)
+		if link.Critical {
+			critical = append(critical, svgLinkPath(source, target))
+		}
+	}
+	b.WriteString("    </g>\n")
+	if len(critical) > 0 {
+		b.WriteString("    <g class=\"critical-links\" fill=\"none\" stroke=\"#8e44ad\" stroke-width=\"3\" stroke-opacity=\"0.8\">\n")
+		for _, path := range critical {
+			fmt.Fprintf(&b, "      <path d=\"%s\"/>\n", path)
+		}
+		b.WriteString("    </g>\n")
+	}
+
+	// Nodes, with labels before folders and after leaves
+	b.WriteString("    <g class=\"nodes\" font-size=\"10\">\n")
+	for _, n := range nodes {
+		radius, strokeWidth := 4, 2
+		if n.id == n.module {
+			radius, strokeWidth = 8, 3
+		} else if n.isPackage {
+			radius = 6
+		}
+		fmt.Fprintf(&b, "      <g transform=\"translate(%s,%s)\">\n", svgNumber(n.x), svgNumber(n.y))
+		fmt.Fprintf(&b, "        <title>%s</title>\n", html.EscapeString(n.id))
+		fmt.Fprintf(&b, "        <circle r=\"%d\" fill=\"%s\" stroke=\"%s\" stroke-width=\"%d\"/>\n",
+			radius, svgFill(colors[n.module]), svgStroke(colors[n.module]), strokeWidth)
+		if n.id == n.module {
+			b.WriteString("        <text dy=\"-1em\" text-anchor=\"middle\" font-weight=\"bold\" fill=\"#fff\">M</text>\n")
+		}
+		if len(n.children) > 0 {
+			fmt.Fprintf(&b, "        <text x=\"%d\" dy=\"0.35em\" text-anchor=\"end\" fill=\"#666\">%s</text>\n", -radius-5, html.EscapeString(n.name))
+		} else {
+			fmt.Fprintf(&b, "        <text x=\"%d\" dy=\"0.35em\" fill=\"#666\">%s</text>\n", radius+5, html.EscapeString(n.name))
+		}
+		b.WriteString("      </g>\n")
+	}
+	b.WriteString("    </g>\n")
+	b.WriteString("  </g>\n")
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// svgTree builds the tree of import paths the viewer lays out: a folder per
+// path element, with types below their package in type graphs. It returns
+// the synthetic root, which is not drawn, and the nodes below it in
+// depth-first order.
+func svgTree(graph *Graph) (*svgNode, []*svgNode) {
+	root := &svgNode{name: "root"}
+	byPath := make(map[string]*svgNode)
+	for _, node := range graph.Nodes {
+		var parts []string
+		if node.Package != "" {
+			parts = append(strings.Split(node.Package, "/"), strings.TrimPrefix(node.ID, node.Package+"."))
+		} else {
+			parts = strings.Split(node.ID, "/")
+		}
+
+		parent := root
+		path := ""
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			if path == "" {
+				path = part
+			} else {
+				path += "/" + part
+			}
+			id := path
+			if i == len(parts)-1 {
+				id = node.ID
+			}
+			n, ok := byPath[id]
+			if !ok {
+				n = &svgNode{id: id, name: part, module: node.Module}
+				byPath[id] = n
+				parent.children = append(parent.children, n)
+			}
+			if i == len(parts)-1 {
+				n.isPackage = true
+				n.module = node.Module
+			}
+			parent = n
+		}
+	}
+
+	var nodes []*svgNode
+	var walk func(n *svgNode)
+	walk = func(n *svgNode) {
+		for _, child := range n.children {
+			nodes = append(nodes, child)
+			walk(child)
+		}
+	}
+	walk(root)
+	return root, nodes
+}
+
+// svgLayout positions the tree: a column per depth, starting with the
+// children of the root, leaves stacked in tree order and parents centered
+// on their children. It returns the number of rows.
+func svgLayout(root *svgNode) int {
+	rows := 0
+	var layout func(n *svgNode, depth int)
+	layout = func(n *svgNode, depth int) {
+		n.depth = depth
+		n.x = float64(depth * svgColumnWidth)
+		if len(n.children) == 0 {
+			n.y = float64(rows * svgRowHeight)
+			rows++
+			return
+		}
+		for _, child := range n.children {
+			layout(child, depth+1)
+		}
+		n.y = (n.children[0].y + n.children[len(n.children)-1].y) / 2
+	}
+	layout(root, -1)
+	return rows
+}
+
+// svgLinkPath is the horizontal Bézier curve the viewer draws between nodes.
+func svgLinkPath(source, target *svgNode) string {
+	mid := svgNumber((source.x + target.x) / 2)
+	return "M" + svgNumber(source.x) + "," + svgNumber(source.y) +
+		"C" + mid + "," + svgNumber(source.y) +
+		" " + mid + "," + svgNumber(target.y) +
+		" " + svgNumber(target.x) + "," + svgNumber(target.y)
+}
+
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// svgFill and svgStroke are the fill and outline of a node in a module of
+// the given color, the outline being darker as in the viewer.
+func svgFill(color string) string {
+	if color == "" {
+		return "#f8f9fa"
+	}
+	return html.EscapeString(color)
+}
+
+func svgStroke(color string) string {
+	if color == "" {
+		return "#dee2e6"
+	}
+	var r, g, b uint8
+	if len(color) != 7 || color[0] != '#' {
+		return html.EscapeString(color)
+	}
+	if _, err := fmt.Sscanf(color[1:], "%02x%02x%02x", &r, &g, &b); err != nil {
+		return html.EscapeString(color)
+	}
+	k := math.Pow(0.7, 0.8)
+	return fmt.Sprintf("#%02x%02x%02x", int(float64(r)*k), int(float64(g)*k), int(float64(b)*k))
+}
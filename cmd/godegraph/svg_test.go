@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func svgGraph() *Graph {
+	return &Graph{
+		Nodes: []Node{
+			{ID: "example.com/app", Module: "example.com/app"},
+			{ID: "example.com/app/api", Module: "example.com/app"},
+			{ID: "example.com/app/internal/db", Module: "example.com/app"},
+			{ID: "example.com/app/internal/log", Module: "example.com/app"},
+			{ID: "example.com/lib<x>", Module: "example.com/lib<x>"},
+		},
+		Links: []Link{
+			{Source: "example.com/app/api", Target: "example.com/app/internal/db", Critical: true},
+			{Source: "example.com/app/internal/db", Target: "example.com/app/internal/log"},
+			{Source: "example.com/app/api", Target: "example.com/missing"},
+		},
+		Modules: []ModuleInfo{
+			{ModulePath: "example.com/app", Color: "#3498db"},
+			{ModulePath: "example.com/lib<x>", Color: "#e74c3c"},
+		},
+	}
+}
+
+func TestSVGTreeLayout(t *testing.T) {
+	root, nodes := svgTree(svgGraph())
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.id)
+	}
+	want := "example.com example.com/app example.com/app/api example.com/app/internal " +
+		"example.com/app/internal/db example.com/app/internal/log example.com/lib<x>"
+	if got := strings.Join(ids, " "); got != want {
+		t.Fatalf("svgTree() nodes = %s, want %s", got, want)
+	}
+	if len(root.children) != 1 || root.children[0] != nodes[0] {
+		t.Fatal("svgTree() nodes do not start below the root")
+	}
+	byID := make(map[string]*svgNode)
+	for _, n := range nodes {
+		byID[n.id] = n
+	}
+	if !byID["example.com/app"].isPackage || byID["example.com/app/internal"].isPackage {
+		t.Error("folders and packages are mixed up")
+	}
+
+	if rows := svgLayout(root); rows != 4 {
+		t.Errorf("svgLayout() = %d rows, want 4", rows)
+	}
+	leaves := []string{"example.com/app/api", "example.com/app/internal/db", "example.com/app/internal/log", "example.com/lib<x>"}
+	for i, id := range leaves {
+		if y := byID[id].y; y != float64(i*svgRowHeight) {
+			t.Errorf("leaf %s at y=%v, want row %d", id, y, i)
+		}
+	}
+	if byID["example.com"].x != 0 {
+		t.Errorf("top-level folder at x=%v, want the first column", byID["example.com"].x)
+	}
+	for _, n := range nodes {
+		if n.x != float64(n.depth*svgColumnWidth) {
+			t.Errorf("%s at x=%v for depth %d", n.id, n.x, n.depth)
+		}
+		if len(n.children) > 0 && n.y != (n.children[0].y+n.children[len(n.children)-1].y)/2 {
+			t.Errorf("%s at y=%v is not centered on its children", n.id, n.y)
+		}
+	}
+}
+
+func TestSVGTreeTypes(t *testing.T) {
+	graph := &Graph{Nodes: []Node{
+		{ID: "example.com/app.Server", Package: "example.com/app", Module: "example.com/app"},
+		{ID: "example.com/app.Handler", Package: "example.com/app", Module: "example.com/app"},
+	}}
+	_, nodes := svgTree(graph)
+	var got []string
+	for _, n := range nodes {
+		got = append(got, n.id+"="+n.name)
+	}
+	want := "example.com=example.com example.com/app=app example.com/app.Server=Server example.com/app.Handler=Handler"
+	if strings.Join(got, " ") != want {
+		t.Errorf("svgTree() = %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	var b strings.Builder
+	if err := writeSVG(&b, svgGraph()); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	decoder := xml.NewDecoder(strings.NewReader(out))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("writeSVG() output is not valid XML: %v\n%s", err, out)
+		}
+	}
+
+	for _, want := range []string{
+		"example.com/lib&lt;x&gt;",
+		`fill="#3498db" stroke="` + svgStroke("#3498db") + `"`,
+		`<g class="critical-links"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("writeSVG() output lacks %s", want)
+		}
+	}
+	if strings.Contains(out, "missing") {
+		t.Error("writeSVG() drew a link to a node outside the graph")
+	}
+	if n := strings.Count(out, "<path"); n != 6+2+1 {
+		t.Errorf("writeSVG() drew %d paths, want 6 tree links, 2 imports and 1 critical link", n)
+	}
+	// The synthetic root of the tree is not drawn, and only the module
+	// roots get a badge
+	if strings.Contains(out, ">root<") {
+		t.Error("writeSVG() drew the root of the tree")
+	}
+	if n := strings.Count(out, ">M</text>"); n != 2 {
+		t.Errorf("writeSVG() drew %d module badges, want 2", n)
+	}
+
+	graph := svgGraph()
+	graph.Links[0].Critical = false
+	b.Reset()
+	if err := writeSVG(&b, graph); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "critical-links") {
+		t.Error("writeSVG() drew an empty critical path")
+	}
+}
+
+func TestSVGStroke(t *testing.T) {
+	tests := []struct{ color, want string }{
+		{"", "#dee2e6"},
+		{"#ffffff", "#bfbfbf"},
+		{"#000000", "#000000"},
+		{"#3498db", "#2772a4"},
+		{"red", "red"},
+		{"#zzzzzz", "#zzzzzz"},
+		{`"><x`, "&#34;&gt;&lt;x"},
+	}
+	for _, tt := range tests {
+		if got := svgStroke(tt.color); got != tt.want {
+			t.Errorf("svgStroke(%q) = %q, want %q", tt.color, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// SymbolUse is an identifier of the imported package referenced by the
+// importing package.
+type SymbolUse struct {
+	Name  string `json:"name"` // e.g. "Client" or "Client.Do" for methods
+	Kind  string `json:"kind"` // func, method, type, var or const
+	Count int    `json:"count"`
+}
+
+// linkKey identifies a link by its endpoints.
+type linkKey struct{ source, target string }
+
+// attachSymbolUses records on each link which identifiers of the target
+// the source package references, and how often.
+func attachSymbolUses(graph *Graph, pkgs []*packages.Package) {
+	links := make(map[linkKey]int)
+	for i, link := range graph.Links {
+		links[linkKey{link.Source, link.Target}] = i
+	}
+
+	type symbolKey struct{ name, kind string }
+	uses := make(map[int]map[symbolKey]int)
+	for _, pkg := range pkgs {
+		for _, obj := range pkg.TypesInfo.Uses {
+			if obj.Pkg() == nil || obj.Pkg() == pkg.Types {
+				continue
+			}
+			idx, ok := links[linkKey{pkg.PkgPath, obj.Pkg().Path()}]
+			if !ok {
+				continue
+			}
+			name, kind := describeObject(obj)
+			if kind == "" {
+				continue
+			}
+			if uses[idx] == nil {
+				uses[idx] = make(map[symbolKey]int)
+			}
+			uses[idx][symbolKey{name, kind}]++
+		}
+	}
+
+	for idx, symbols := range uses {
+		var list []SymbolUse
+		for key, count := range symbols {
+			list = append(list, SymbolUse{Name: key.name, Kind: key.kind, Count: count})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Name < list[j].Name
+		})
+		graph.Links[idx].Symbols = list
+	}
+}
+
+// describeObject returns the display name and kind of a referenced
+// object, or an empty kind for objects that are not reported, like struct
+// fields, which are covered by their type.
+func describeObject(obj types.Object) (string, string) {
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig, _ := obj.Type().(*types.Signature)
+		if sig != nil && sig.Recv() != nil {
+			return receiverName(sig.Recv().Type()) + "." + obj.Name(), "method"
+		}
+		return obj.Name(), "func"
+	case *types.TypeName:
+		return obj.Name(), "type"
+	case *types.Const:
+		return obj.Name(), "const"
+	case *types.Var:
+		if obj.IsField() {
+			return "", ""
+		}
+		return obj.Name(), "var"
+	}
+	return "", ""
+}
+
+// receiverName returns the name of a method receiver's base type.
+func receiverName(t types.Type) string {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	switch t := t.(type) {
+	case *types.Named:
+		return t.Obj().Name()
+	case *types.Alias:
+		return t.Obj().Name()
+	}
+	return types.TypeString(t, func(*types.Package) string { return "" })
+}
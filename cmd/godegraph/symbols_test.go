@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAttachSymbolUses(t *testing.T) {
+	graph, pkgs := loadTypedTestPackages(t)
+	attachSymbolUses(graph, pkgs)
+
+	want := map[string][]SymbolUse{
+		"example.com/m/app": {
+			{Name: "Base", Kind: "type", Count: 1},
+			{Name: "Client", Kind: "type", Count: 1},
+			{Name: "Client.Do", Kind: "method", Count: 2},
+			{Name: "Default", Kind: "var", Count: 1},
+			{Name: "Doer", Kind: "type", Count: 2},
+			{Name: "New", Kind: "func", Count: 2},
+			{Name: "Version", Kind: "const", Count: 1},
+		},
+		"example.com/m/cmd": {{Name: "Run", Kind: "func", Count: 1}},
+		"example.com/m/tools/plugin": {
+			{Name: "Doer", Kind: "type", Count: 1},
+			{Name: "Doer.Do", Kind: "method", Count: 1},
+			{Name: "New", Kind: "func", Count: 1},
+		},
+	}
+	for _, link := range graph.Links {
+		if !reflect.DeepEqual(link.Symbols, want[link.Source]) {
+			t.Errorf("symbols of %s -> %s = %+v, want %+v", link.Source, link.Target, link.Symbols, want[link.Source])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// typedLoadMode is the information loaded for the analyses that need
+// syntax trees and type information, which "go list" does not provide.
+const typedLoadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports |
+	packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo
+
+// loadTypedPackages parses and type-checks the packages of all modules for
+// the given build configuration. Ignored and excluded packages are left
+// out. Packages with errors are kept with whatever information could be
+// recovered, and the errors are reported as warnings.
+func loadTypedPackages(modules []ModuleInfo, build buildConfig, rootDir string) ([]*packages.Package, error) {
+	groups, err := loadTypedModules(modules, build, rootDir, typedLoadMode)
+	if err != nil {
+		return nil, err
+	}
+	var result []*packages.Package
+	for _, pkgs := range groups {
+		result = append(result, pkgs...)
+	}
+	return result, nil
+}
+
+// loadTypedModules is like loadTypedPackages with the given load mode, but
+// keeps the packages of each module apart: packages loaded for different
+// modules do not share type objects.
+func loadTypedModules(modules []ModuleInfo, build buildConfig, rootDir string, mode packages.LoadMode) ([][]*packages.Package, error) {
+	var result [][]*packages.Package
+	seen := make(map[string]bool)
+	for _, mod := range modules {
+		fmt.Fprintf(os.Stderr, "Type-checking module in directory: %s\n", mod.Dir)
+		cfg := &packages.Config{
+			Mode: mode,
+			Dir:  mod.Dir,
+			Env:  append(os.Environ(), build.env()...),
+		}
+		if len(build.Tags) > 0 {
+			cfg.BuildFlags = []string{"-tags=" + strings.Join(build.Tags, ",")}
+		}
+
+		pkgs, err := packages.Load(cfg, "./...")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load packages in %s: %v", mod.Dir, err)
+		}
+		var modulePkgs []*packages.Package
+		for _, pkg := range pkgs {
+			if seen[pkg.PkgPath] || pkg.Types == nil || pkg.TypesInfo == nil {
+				continue
+			}
+			if len(pkg.GoFiles) > 0 && shouldIgnorePath(filepath.Dir(pkg.GoFiles[0]), rootDir, true) {
+				continue
+			}
+			if shouldExcludePackage(pkg.PkgPath) {
+				continue
+			}
+			for _, e := range pkg.Errors {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", pkg.PkgPath, e)
+			}
+			seen[pkg.PkgPath] = true
+			modulePkgs = append(modulePkgs, pkg)
+		}
+		result = append(result, modulePkgs)
+	}
+	return result, nil
+}
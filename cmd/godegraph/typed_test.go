@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// typedTestFiles is a module with a nested module importing it, used by
+// the tests of the analyses on type-checked packages.
+var typedTestFiles = map[string]string{
+	"go.mod": "module example.com/m\n\ngo 1.22\n",
+	"lib/lib.go": `package lib
+
+type Doer interface{ Do() }
+
+type Base struct{}
+
+type Client struct {
+	Base
+	Name string
+}
+
+//go:noinline
+func (c *Client) Do() {}
+
+//go:noinline
+func New() *Client { return &Client{} }
+
+const Version = 1
+
+var Default = New()
+`,
+	"app/app.go": `package app
+
+import "example.com/m/lib"
+
+type Server struct {
+	lib.Base
+	clients map[string][]*lib.Client
+	handler func(lib.Doer)
+}
+
+type runner interface {
+	lib.Doer
+	Run()
+}
+
+//go:noinline
+func Run() {
+	c := lib.New()
+	c.Do()
+	c.Do()
+	_ = c.Name
+	_ = lib.Version
+	_ = lib.Default
+	var s Server
+	s.clients = nil
+}
+
+func unused() { lib.New() }
+`,
+	"cmd/main.go": `package main
+
+import "example.com/m/app"
+
+func main() { app.Run() }
+`,
+	"winsvc/svc_windows.go": "package winsvc\n",
+	"tools/go.mod":          "module example.com/m/tools\n\ngo 1.22\n\nrequire example.com/m v0.0.0\n\nreplace example.com/m => ../\n",
+	"tools/plugin/plugin.go": `package plugin
+
+import "example.com/m/lib"
+
+type Plugin struct{}
+
+func (Plugin) Do() {}
+
+func Register(d lib.Doer) { d.Do() }
+
+func init() {
+	Register(Plugin{})
+	Register(lib.New())
+}
+`,
+}
+
+// writeTypedTestModules writes typedTestFiles to a temporary directory and
+// returns its modules.
+func writeTypedTestModules(t *testing.T) []ModuleInfo {
+	t.Helper()
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+	root := t.TempDir()
+	for name, content := range typedTestFiles {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return []ModuleInfo{
+		{ModulePath: "example.com/m", Dir: root},
+		{ModulePath: "example.com/m/tools", Dir: filepath.Join(root, "tools")},
+	}
+}
+
+// typedTestGraph is the package graph of typedTestFiles.
+func typedTestGraph(modules []ModuleInfo) *Graph {
+	return &Graph{
+		Modules: modules,
+		Nodes: []Node{
+			{ID: "example.com/m/lib", Module: "example.com/m"},
+			{ID: "example.com/m/app", Module: "example.com/m"},
+			{ID: "example.com/m/cmd", Module: "example.com/m"},
+			{ID: "example.com/m/tools/plugin", Module: "example.com/m/tools"},
+		},
+		Links: []Link{
+			{Source: "example.com/m/app", Target: "example.com/m/lib"},
+			{Source: "example.com/m/cmd", Target: "example.com/m/app"},
+			{Source: "example.com/m/tools/plugin", Target: "example.com/m/lib"},
+		},
+	}
+}
+
+func loadTypedTestPackages(t *testing.T) (*Graph, []*packages.Package) {
+	t.Helper()
+	modules := writeTypedTestModules(t)
+	pkgs, err := loadTypedPackages(modules, buildConfig{}, modules[0].Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return typedTestGraph(modules), pkgs
+}
+
+func TestLoadTypedPackages(t *testing.T) {
+	_, pkgs := loadTypedTestPackages(t)
+	var paths []string
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.PkgPath)
+	}
+	sort.Strings(paths)
+	// The root packages of both modules, without their dependencies
+	want := []string{"example.com/m/app", "example.com/m/cmd", "example.com/m/lib", "example.com/m/tools/plugin"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("loadTypedPackages() = %q, want %q", paths, want)
+	}
+}
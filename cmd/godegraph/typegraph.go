@@ -0,0 +1,217 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of type graph links.
+const (
+	typeLinkEmbeds     = "embeds"
+	typeLinkField      = "field"
+	typeLinkImplements = "implements"
+)
+
+// typeNodeID returns the node ID of a named type.
+func typeNodeID(obj *types.TypeName) string {
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// typeKind classifies a named type for display.
+func typeKind(obj *types.TypeName) string {
+	switch obj.Type().Underlying().(type) {
+	case *types.Interface:
+		return "interface"
+	case *types.Struct:
+		return "struct"
+	}
+	return "type"
+}
+
+// buildTypeGraph returns the graph of the named types declared in the
+// selected packages. Links point from a type to the types it embeds, the
+// types of its fields and the interfaces it implements; links to types
+// outside the selected packages are left out. Nodes keep the module of
+// their package in graph, so the viewer colors them the same way.
+func buildTypeGraph(graph *Graph, pkgs []*packages.Package, selected nodeSet, exportedOnly bool) *Graph {
+	moduleOf := make(map[string]string)
+	for _, node := range graph.Nodes {
+		moduleOf[node.ID] = node.Module
+	}
+
+	result := &Graph{Modules: graph.Modules, Viewer: graph.Viewer}
+	nodeIndex := make(map[string]int)
+	var named []*types.TypeName
+	var packageOf []*packages.Package
+	for _, pkg := range pkgs {
+		if !selected[pkg.PkgPath] {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			obj, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || obj.IsAlias() || (exportedOnly && !obj.Exported()) {
+				continue
+			}
+			nodeIndex[typeNodeID(obj)] = len(result.Nodes)
+			result.Nodes = append(result.Nodes, Node{
+				ID:      typeNodeID(obj),
+				Module:  moduleOf[pkg.PkgPath],
+				Package: pkg.PkgPath,
+				Kind:    typeKind(obj),
+			})
+			named = append(named, obj)
+			packageOf = append(packageOf, pkg)
+		}
+	}
+
+	linkIndex := make(map[linkKey]int)
+	addLink := func(source string, target *types.TypeName, kind string) {
+		if target.Pkg() == nil {
+			return
+		}
+		targetID := typeNodeID(target)
+		if _, ok := nodeIndex[targetID]; !ok || targetID == source {
+			return
+		}
+		key := linkKey{source: source, target: targetID}
+		idx, ok := linkIndex[key]
+		if !ok {
+			idx = len(result.Links)
+			linkIndex[key] = idx
+			result.Links = append(result.Links, Link{Source: source, Target: targetID})
+		}
+		if !containsString(result.Links[idx].Kinds, kind) {
+			result.Links[idx].Kinds = append(result.Links[idx].Kinds, kind)
+		}
+	}
+
+	// Embedding and field types
+	for _, obj := range named {
+		id := typeNodeID(obj)
+		switch underlying := obj.Type().Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < underlying.NumFields(); i++ {
+				field := underlying.Field(i)
+				kind := typeLinkField
+				if field.Embedded() {
+					kind = typeLinkEmbeds
+				}
+				visitNamedTypes(field.Type(), func(target *types.TypeName) {
+					addLink(id, target, kind)
+				})
+			}
+		case *types.Interface:
+			for i := 0; i < underlying.NumEmbeddeds(); i++ {
+				visitNamedTypes(underlying.EmbeddedType(i), func(target *types.TypeName) {
+					addLink(id, target, typeLinkEmbeds)
+				})
+			}
+		}
+	}
+
+	// Interface implementations. Packages loaded from different modules do
+	// not share type objects, so each interface is looked up in the universe
+	// of the implementing type before checking its method set.
+	universes := make(map[*token.FileSet]map[string]*types.Package)
+	var interfaces []*types.TypeName
+	for _, obj := range named {
+		if iface, ok := obj.Type().Underlying().(*types.Interface); ok && iface.NumMethods() > 0 && !isGeneric(obj) {
+			interfaces = append(interfaces, obj)
+		}
+	}
+	for i, obj := range named {
+		if _, ok := obj.Type().Underlying().(*types.Interface); ok || isGeneric(obj) {
+			continue
+		}
+		pkg := packageOf[i]
+		universe, ok := universes[pkg.Fset]
+		if !ok {
+			universe = typeUniverse(pkgs, pkg.Fset)
+			universes[pkg.Fset] = universe
+		}
+		for _, iface := range interfaces {
+			local := iface
+			if p, ok := universe[iface.Pkg().Path()]; ok {
+				if found, ok := p.Scope().Lookup(iface.Name()).(*types.TypeName); ok {
+					local = found
+				}
+			}
+			it, ok := local.Type().Underlying().(*types.Interface)
+			if !ok {
+				continue
+			}
+			if types.Implements(obj.Type(), it) || types.Implements(types.NewPointer(obj.Type()), it) {
+				addLink(typeNodeID(obj), iface, typeLinkImplements)
+			}
+		}
+	}
+
+	for i := range result.Links {
+		sort.Strings(result.Links[i].Kinds)
+	}
+	return result
+}
+
+// visitNamedTypes calls visit for the named types making up t: t itself,
+// the elements of pointers, slices, arrays, maps and channels, the fields
+// of anonymous structs and type arguments. Function types are not
+// followed.
+func visitNamedTypes(t types.Type, visit func(*types.TypeName)) {
+	switch t := t.(type) {
+	case *types.Alias:
+		visitNamedTypes(types.Unalias(t), visit)
+	case *types.Named:
+		visit(t.Obj())
+		args := t.TypeArgs()
+		for i := 0; i < args.Len(); i++ {
+			visitNamedTypes(args.At(i), visit)
+		}
+	case *types.Pointer:
+		visitNamedTypes(t.Elem(), visit)
+	case *types.Slice:
+		visitNamedTypes(t.Elem(), visit)
+	case *types.Array:
+		visitNamedTypes(t.Elem(), visit)
+	case *types.Map:
+		visitNamedTypes(t.Key(), visit)
+		visitNamedTypes(t.Elem(), visit)
+	case *types.Chan:
+		visitNamedTypes(t.Elem(), visit)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			visitNamedTypes(t.Field(i).Type(), visit)
+		}
+	}
+}
+
+// isGeneric reports whether obj declares type parameters.
+func isGeneric(obj *types.TypeName) bool {
+	named, ok := obj.Type().(*types.Named)
+	return ok && named.TypeParams().Len() > 0
+}
+
+// typeUniverse returns, by path, all packages known to the type-checking
+// run that produced fset: its root packages and everything they import.
+func typeUniverse(pkgs []*packages.Package, fset *token.FileSet) map[string]*types.Package {
+	universe := make(map[string]*types.Package)
+	var add func(p *types.Package)
+	add = func(p *types.Package) {
+		if _, ok := universe[p.Path()]; ok {
+			return
+		}
+		universe[p.Path()] = p
+		for _, imp := range p.Imports() {
+			add(imp)
+		}
+	}
+	for _, pkg := range pkgs {
+		if pkg.Fset == fset {
+			add(pkg.Types)
+		}
+	}
+	return universe
+}
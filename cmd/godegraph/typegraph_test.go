@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBuildTypeGraph(t *testing.T) {
+	graph, pkgs := loadTypedTestPackages(t)
+	selected := make(nodeSet)
+	for _, node := range graph.Nodes {
+		selected[node.ID] = true
+	}
+
+	tests := []struct {
+		exportedOnly bool
+		nodes        []string
+		links        []string
+	}{
+		{false, []string{
+			"example.com/m/app.Server struct example.com/m",
+			"example.com/m/app.runner interface example.com/m",
+			"example.com/m/lib.Base struct example.com/m",
+			"example.com/m/lib.Client struct example.com/m",
+			"example.com/m/lib.Doer interface example.com/m",
+			"example.com/m/tools/plugin.Plugin struct example.com/m/tools",
+		}, []string{
+			"example.com/m/app.Server -> example.com/m/lib.Base [embeds]",
+			// Function types are not followed, so handler adds no link
+			"example.com/m/app.Server -> example.com/m/lib.Client [field]",
+			"example.com/m/app.runner -> example.com/m/lib.Doer [embeds]",
+			"example.com/m/lib.Client -> example.com/m/lib.Base [embeds]",
+			"example.com/m/lib.Client -> example.com/m/lib.Doer [implements]",
+			// Across modules, with type objects of separate loads
+			"example.com/m/tools/plugin.Plugin -> example.com/m/lib.Doer [implements]",
+		}},
+		{true, []string{
+			"example.com/m/app.Server struct example.com/m",
+			"example.com/m/lib.Base struct example.com/m",
+			"example.com/m/lib.Client struct example.com/m",
+			"example.com/m/lib.Doer interface example.com/m",
+			"example.com/m/tools/plugin.Plugin struct example.com/m/tools",
+		}, []string{
+			"example.com/m/app.Server -> example.com/m/lib.Base [embeds]",
+			"example.com/m/app.Server -> example.com/m/lib.Client [field]",
+			"example.com/m/lib.Client -> example.com/m/lib.Base [embeds]",
+			"example.com/m/lib.Client -> example.com/m/lib.Doer [implements]",
+			"example.com/m/tools/plugin.Plugin -> example.com/m/lib.Doer [implements]",
+		}},
+	}
+	for _, tt := range tests {
+		typeGraph := buildTypeGraph(graph, pkgs, selected, tt.exportedOnly)
+		var nodes, links []string
+		for _, node := range typeGraph.Nodes {
+			if !strings.HasPrefix(node.ID, node.Package+".") {
+				t.Errorf("type %s outside of its package %s", node.ID, node.Package)
+			}
+			nodes = append(nodes, node.ID+" "+node.Kind+" "+node.Module)
+		}
+		for _, link := range typeGraph.Links {
+			links = append(links, link.Source+" -> "+link.Target+" ["+strings.Join(link.Kinds, ",")+"]")
+		}
+		sort.Strings(nodes)
+		sort.Strings(links)
+		if !reflect.DeepEqual(nodes, tt.nodes) {
+			t.Errorf("exportedOnly=%v: nodes = %q, want %q", tt.exportedOnly, nodes, tt.nodes)
+		}
+		if !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("exportedOnly=%v: links = %q, want %q", tt.exportedOnly, links, tt.links)
+		}
+	}
+
+	// Types of unselected packages are left out, and so are links to them
+	typeGraph := buildTypeGraph(graph, pkgs, nodeSet{"example.com/m/app": true}, false)
+	if len(typeGraph.Nodes) != 2 || len(typeGraph.Links) != 0 {
+		t.Errorf("type graph of app = %+v", typeGraph)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// UnusedReport lists cleanup candidates per module.
+type UnusedReport struct {
+	Modules []ModuleUnused `json:"modules"`
+}
+
+// ModuleUnused holds the cleanup candidates of one module.
+type ModuleUnused struct {
+	Module   string         `json:"module"`
+	Packages []string       `json:"unusedPackages,omitempty"`
+	Symbols  []UnusedSymbol `json:"unusedSymbols,omitempty"`
+}
+
+// UnusedSymbol is an exported identifier no other internal package uses.
+type UnusedSymbol struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+}
+
+// findUnusedPackages returns the internal packages that no other internal
+// package imports. Main packages, packages without non-test files and
+// packages imported by tests only are not reported.
+func findUnusedPackages(graph *Graph) []string {
+	imported := make(map[string]bool)
+	for _, link := range graph.Links {
+		imported[link.Target] = true
+	}
+	for _, pkg := range graph.packages {
+		// The external test package of a package imports it, which does
+		// not make it used
+		testImports := append(append([]string(nil), pkg.TestImports...), pkg.XTestImports...)
+		for _, imp := range testImports {
+			if imp != pkg.ImportPath {
+				imported[imp] = true
+			}
+		}
+	}
+
+	var unused []string
+	for _, node := range graph.Nodes {
+		pkg := graph.packages[node.ID]
+		if imported[node.ID] || pkg.Name == "main" || len(pkg.GoFiles)+len(pkg.CgoFiles) == 0 {
+			continue
+		}
+		unused = append(unused, node.ID)
+	}
+	return unused
+}
+
+// findUnusedSymbols returns the exported package-level identifiers of the
+// given packages that no other of the packages references. A type counts
+// as used when one of its methods is used. Main packages are skipped.
+func findUnusedSymbols(pkgs []*packages.Package) []UnusedSymbol {
+	// Objects are identified by package path and name, since packages
+	// type-checked separately do not share types.Object values
+	used := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, obj := range pkg.TypesInfo.Uses {
+			if obj.Pkg() == nil || obj.Pkg() == pkg.Types {
+				continue
+			}
+			name, kind := describeObject(obj)
+			if kind == "" {
+				continue
+			}
+			used[obj.Pkg().Path()+"."+name] = true
+			if kind == "method" {
+				receiver, _, _ := strings.Cut(name, ".")
+				used[obj.Pkg().Path()+"."+receiver] = true
+			}
+		}
+	}
+
+	var unused []UnusedSymbol
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if !obj.Exported() || used[pkg.PkgPath+"."+name] {
+				continue
+			}
+			_, kind := describeObject(obj)
+			if kind == "" {
+				continue
+			}
+			unused = append(unused, UnusedSymbol{Package: pkg.PkgPath, Name: name, Kind: kind})
+		}
+	}
+	return unused
+}
+
+// buildUnusedReport groups unused packages and symbols by module.
+func buildUnusedReport(graph *Graph, pkgs []*packages.Package) *UnusedReport {
+	moduleOf := make(map[string]string)
+	for _, node := range graph.Nodes {
+		moduleOf[node.ID] = node.Module
+	}
+
+	byModule := make(map[string]*ModuleUnused)
+	report := &UnusedReport{}
+	for _, mod := range graph.Modules {
+		report.Modules = append(report.Modules, ModuleUnused{Module: mod.ModulePath})
+	}
+	for i := range report.Modules {
+		byModule[report.Modules[i].Module] = &report.Modules[i]
+	}
+
+	for _, pkgPath := range findUnusedPackages(graph) {
+		if mod, ok := byModule[moduleOf[pkgPath]]; ok {
+			mod.Packages = append(mod.Packages, pkgPath)
+		}
+	}
+	for _, sym := range findUnusedSymbols(pkgs) {
+		if mod, ok := byModule[moduleOf[sym.Package]]; ok {
+			mod.Symbols = append(mod.Symbols, sym)
+		}
+	}
+
+	for i := range report.Modules {
+		mod := &report.Modules[i]
+		sort.Strings(mod.Packages)
+		sort.SliceStable(mod.Symbols, func(a, b int) bool {
+			return mod.Symbols[a].Package < mod.Symbols[b].Package
+		})
+	}
+	return report
+}
+
+// writeUnusedReport prints the report as text, one section per module.
+func writeUnusedReport(w io.Writer, report *UnusedReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, mod := range report.Modules {
+		fmt.Fprintf(tw, "Module %s\n", mod.Module)
+		if len(mod.Packages) == 0 && len(mod.Symbols) == 0 {
+			fmt.Fprintf(tw, "  no cleanup candidates\n\n")
+			continue
+		}
+		if len(mod.Packages) > 0 {
+			fmt.Fprintf(tw, "  Packages not imported by any internal package (%d):\n", len(mod.Packages))
+			for _, pkg := range mod.Packages {
+				fmt.Fprintf(tw, "    %s\n", pkg)
+			}
+		}
+		if len(mod.Symbols) > 0 {
+			fmt.Fprintf(tw, "  Exported identifiers not used by other internal packages (%d):\n", len(mod.Symbols))
+			for _, sym := range mod.Symbols {
+				fmt.Fprintf(tw, "    %s\t%s\t%s\n", sym.Package, sym.Name, sym.Kind)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
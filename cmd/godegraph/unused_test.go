@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindUnusedPackages(t *testing.T) {
+	pkgs := []Package{
+		{ImportPath: "example.com/app", Name: "main", GoFiles: []string{"main.go"}, Imports: []string{"example.com/used"}},
+		{ImportPath: "example.com/used", Name: "used", GoFiles: []string{"used.go"}},
+		// Imported by its own external test only
+		{ImportPath: "example.com/dead", Name: "dead", GoFiles: []string{"dead.go"}, XTestImports: []string{"example.com/dead"}},
+		// Imported by the tests of another package only
+		{ImportPath: "example.com/testutil", Name: "testutil", GoFiles: []string{"testutil.go"}},
+		{ImportPath: "example.com/other", Name: "other", GoFiles: []string{"other.go"}, TestImports: []string{"example.com/testutil"}},
+		{ImportPath: "example.com/testsonly", Name: "testsonly", TestGoFiles: []string{"x_test.go"}},
+	}
+	graph := &Graph{packages: make(map[string]Package)}
+	for _, pkg := range pkgs {
+		graph.packages[pkg.ImportPath] = pkg
+		graph.Nodes = append(graph.Nodes, Node{ID: pkg.ImportPath})
+		for _, imp := range pkg.Imports {
+			graph.Links = append(graph.Links, Link{Source: pkg.ImportPath, Target: imp})
+		}
+	}
+
+	want := []string{"example.com/dead", "example.com/other"}
+	if got := findUnusedPackages(graph); !reflect.DeepEqual(got, want) {
+		t.Errorf("findUnusedPackages() = %v, want %v", got, want)
+	}
+}
+
+func TestBuildUnusedReport(t *testing.T) {
+	graph, pkgs := loadTypedTestPackages(t)
+	graph.packages = make(map[string]Package)
+	for _, pkg := range pkgs {
+		graph.packages[pkg.PkgPath] = Package{ImportPath: pkg.PkgPath, Name: pkg.Name, GoFiles: pkg.GoFiles}
+	}
+
+	report := buildUnusedReport(graph, pkgs)
+	want := &UnusedReport{Modules: []ModuleUnused{
+		{Module: "example.com/m", Symbols: []UnusedSymbol{
+			{Package: "example.com/m/app", Name: "Server", Kind: "type"},
+		}},
+		// Identifiers used within their own package only are unused
+		{Module: "example.com/m/tools", Packages: []string{"example.com/m/tools/plugin"}, Symbols: []UnusedSymbol{
+			{Package: "example.com/m/tools/plugin", Name: "Plugin", Kind: "type"},
+			{Package: "example.com/m/tools/plugin", Name: "Register", Kind: "func"},
+		}},
+	}}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("buildUnusedReport() = %+v, want %+v", report, want)
+	}
+
+	var b strings.Builder
+	if err := writeUnusedReport(&b, report); err != nil {
+		t.Fatal(err)
+	}
+	wantText := `Module example.com/m
+  Exported identifiers not used by other internal packages (1):
+    example.com/m/app  Server  type
+
+Module example.com/m/tools
+  Packages not imported by any internal package (1):
+    example.com/m/tools/plugin
+  Exported identifiers not used by other internal packages (2):
+    example.com/m/tools/plugin  Plugin    type
+    example.com/m/tools/plugin  Register  func
+
+`
+	if b.String() != wantText {
+		t.Errorf("writeUnusedReport() =\n%s\nwant:\n%s", b.String(), wantText)
+	}
+
+	b.Reset()
+	if err := writeUnusedReport(&b, &UnusedReport{Modules: []ModuleUnused{{Module: "example.com/clean"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Module example.com/clean\n  no cleanup candidates\n\n"; b.String() != want {
+		t.Errorf("writeUnusedReport() = %q, want %q", b.String(), want)
+	}
+}